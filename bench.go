@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+)
+
+type benchCall struct {
+	name   string
+	method string
+	params interface{}
+}
+
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:3030", "Near JSON-RPC URL")
+	accountId := fs.String("accountId", "test", "Staking pool account id used for the view call")
+	iterations := fs.Int("n", 20, "number of requests per endpoint")
+	fs.Parse(args)
+
+	if *iterations <= 0 {
+		fmt.Fprintln(os.Stderr, "bench: -n must be positive")
+		os.Exit(2)
+	}
+
+	client := nearapi.NewClient(*url)
+	calls := []benchCall{
+		{"status", "status", nil},
+		{"validators", "validators", "latest"},
+		{"view_call", "query", map[string]interface{}{"request_type": "call_function",
+			"finality":    "final",
+			"account_id":  *accountId,
+			"method_name": "get_accounts",
+			"args_base64": "eyJmcm9tX2luZGV4IjogMCwgImxpbWl0IjogMTAwfQ=="}},
+	}
+
+	fmt.Printf("Benchmarking %s with %d requests per endpoint\n\n", *url, *iterations)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "endpoint\terrors\tmin\tavg\tp50\tp90\tp99\tmax\t")
+	for _, c := range calls {
+		var durations []time.Duration
+		failed := 0
+		for i := 0; i < *iterations; i++ {
+			start := time.Now()
+			_, err := client.Get(c.method, c.params)
+			if err != nil {
+				failed++
+				continue
+			}
+			durations = append(durations, time.Since(start))
+		}
+		if len(durations) == 0 {
+			fmt.Fprintf(w, "%s\t%d\t-\t-\t-\t-\t-\t-\t\n", c.name, failed)
+			continue
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", c.name, failed,
+			round(durations[0]),
+			round(total/time.Duration(len(durations))),
+			round(percentile(durations, 0.50)),
+			round(percentile(durations, 0.90)),
+			round(percentile(durations, 0.99)),
+			round(durations[len(durations)-1]))
+	}
+	w.Flush()
+}
+
+// percentile expects durations to be sorted in ascending order.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(durations))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(durations) {
+		idx = len(durations) - 1
+	}
+	return durations[idx]
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// chainLabelGatherer adds the chain_id and genesis_hash of the node to all
+// metrics, so that exporters of different networks can be told apart in one
+// Prometheus. The labels are looked up once, metrics gathered before the
+// node answered are passed through unlabeled.
+type chainLabelGatherer struct {
+	prometheus.Gatherer
+	client *nearapi.Client
+
+	mu     sync.Mutex
+	labels []*dto.LabelPair
+}
+
+func (g *chainLabelGatherer) chainLabels() []*dto.LabelPair {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.labels != nil {
+		return g.labels
+	}
+	r, err := g.client.Get("status", nil)
+	if err != nil || r.Status.ChainId == "" {
+		logging.Warn("chain labels: status unavailable", "err", err)
+		return nil
+	}
+	g.labels = []*dto.LabelPair{labelPair("chain_id", r.Status.ChainId)}
+	if r.Status.GenesisHash != "" {
+		g.labels = append(g.labels, labelPair("genesis_hash", r.Status.GenesisHash))
+	}
+	return g.labels
+}
+
+// Gather labels copies of the gathered metrics, which may be shared, e.g.
+// the ones cached by the poller.
+func (g *chainLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	labels := g.chainLabels()
+	if len(labels) == 0 {
+		return mfs, err
+	}
+	res := make([]*dto.MetricFamily, len(mfs))
+	for i, mf := range mfs {
+		family := *mf
+		family.Metric = make([]*dto.Metric, len(mf.Metric))
+		for j, m := range mf.Metric {
+			metric := *m
+			metric.Label = withLabels(m.Label, labels)
+			family.Metric[j] = &metric
+		}
+		res[i] = &family
+	}
+	return res, err
+}
+
+// withLabels returns pairs and the labels not present in pairs yet.
+func withLabels(pairs []*dto.LabelPair, labels []*dto.LabelPair) []*dto.LabelPair {
+	res := append([]*dto.LabelPair(nil), pairs...)
+	for _, l := range labels {
+		present := false
+		for _, p := range pairs {
+			if p.GetName() == l.GetName() {
+				present = true
+			}
+		}
+		if !present {
+			res = append(res, l)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].GetName() < res[j].GetName() })
+	return res
+}
+
+func labelPair(name string, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestChainLabelGatherer(t *testing.T) {
+	srv := rpctest.NewServer(rpctest.NewNode())
+	defer srv.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "near_test", Help: "Test gauge"})
+	gauge.Set(1)
+	registry.MustRegister(gauge)
+	p := newPoller(registry, time.Hour, nil)
+	p.Poll()
+	g := &chainLabelGatherer{Gatherer: p, client: nearapi.NewClient(srv.URL)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.Gather(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := `
+# HELP near_test Test gauge
+# TYPE near_test gauge
+near_test{chain_id="testnet",genesis_hash="GenesisHash111111111111111111111111111111111"} 1
+`
+	if err := testutil.GatherAndCompare(g, strings.NewReader(want), "near_test"); err != nil {
+		t.Error(err)
+	}
+	// The metrics cached by the poller are not labeled.
+	unlabeled := "\n# HELP near_test Test gauge\n# TYPE near_test gauge\nnear_test 1\n"
+	if err := testutil.GatherAndCompare(p, strings.NewReader(unlabeled), "near_test"); err != nil {
+		t.Error(err)
+	}
+}
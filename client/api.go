@@ -2,13 +2,18 @@ package nearapi
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/madnadyka/near-prometheus-exporter/tracing"
 )
 
 type StatusResult struct {
@@ -17,8 +22,13 @@ type StatusResult struct {
 			Version string `json:"version"`
 			Build   string `json:"build"`
 		} `json:"version"`
-		ChainId string `json:"chain_id"`
-		RpcAddr string `json:"rpc_addr"`
+		ChainId               string `json:"chain_id"`
+		GenesisHash           string `json:"genesis_hash"`
+		ValidatorAccountId    string `json:"validator_account_id"`
+		ValidatorPublicKey    string `json:"validator_public_key"`
+		ProtocolVersion       int    `json:"protocol_version"`
+		LatestProtocolVersion int    `json:"latest_protocol_version"`
+		RpcAddr               string `json:"rpc_addr"`
 		//Validators []string `json:"validators"`
 		SyncInfo struct {
 			LatestBlockHash   string `json:"latest_block_hash"`
@@ -36,18 +46,20 @@ type Validator struct {
 	Stake     string `json:"stake"`
 }
 
+type CurrentValidator struct {
+	Validator
+	IsSlashed         bool  `json:"is_slashed"`
+	Shards            []int `json:"shards"`
+	NumProducedBlocks int64 `json:"num_produced_blocks"`
+	NumExpectedBlocks int64 `json:"num_expected_blocks"`
+	NumProducedChunks int64 `json:"num_produced_chunks"`
+	NumExpectedChunks int64 `json:"num_expected_chunks"`
+}
+
 type ValidatorsResult struct {
 	Validators struct {
-		CurrentValidators []struct {
-			Validator
-			IsSlashed         bool  `json:"is_slashed"`
-			Shards            []int `json:"shards"`
-			NumProducedBlocks int64 `json:"num_produced_blocks"`
-			NumExpectedBlocks int64 `json:"num_expected_blocks"`
-			NumProducedChunks int64 `json:"num_produced_chunks"`
-			NumExpectedChunks int64 `json:"num_expected_chunks"`
-		} `json:"current_validators"`
-		NextValidators []struct {
+		CurrentValidators []CurrentValidator `json:"current_validators"`
+		NextValidators    []struct {
 			Validator
 			Shards []int `json:"shards"`
 		} `json:"next_validators"`
@@ -57,8 +69,8 @@ type ValidatorsResult struct {
 		EpochHeight      int64 `json:"epoch_height"`
 		EpochStartHeight int64 `json:"epoch_start_height"`
 		PrevEpochKickOut []struct {
-			AccountId string      `json:"account_id"`
-			Reason    interface{} `json:"reason"`
+			AccountId string        `json:"account_id"`
+			Reason    KickoutReason `json:"reason"`
 		} `json:"prev_epoch_kickout"`
 	} `json:"result_validators"`
 }
@@ -69,18 +81,180 @@ type QueryResult struct {
 		BlockHeight int           `json:"block_height"`
 		Logs        []interface{} `json:"logs"`
 		Result      []int32       `json:"result_query"`
+		// Fields of view_account queries.
+		Amount       string `json:"amount"`
+		Locked       string `json:"locked"`
+		CodeHash     string `json:"code_hash"`
+		StorageUsage int64  `json:"storage_usage"`
 	} `json:"result_query"`
 }
 
+// Rational is a fraction, encoded as [numerator, denominator].
+type Rational [2]int64
+
+// Float64 returns the value of the fraction, 0 if the denominator is 0.
+func (r Rational) Float64() float64 {
+	if r[1] == 0 {
+		return 0
+	}
+	return float64(r[0]) / float64(r[1])
+}
+
+type ProtocolConfigResult struct {
+	ProtocolConfig struct {
+		ProtocolVersion               int      `json:"protocol_version"`
+		EpochLength                   int64    `json:"epoch_length"`
+		NumBlockProducerSeats         int64    `json:"num_block_producer_seats"`
+		NumBlockProducerSeatsPerShard []int64  `json:"num_block_producer_seats_per_shard"`
+		NumChunkOnlyProducerSeats     int64    `json:"num_chunk_only_producer_seats"`
+		NumChunkProducerSeats         int64    `json:"num_chunk_producer_seats"`
+		BlockProducerKickoutThreshold int      `json:"block_producer_kickout_threshold"`
+		ChunkProducerKickoutThreshold int      `json:"chunk_producer_kickout_threshold"`
+		NumBlocksPerYear              int64    `json:"num_blocks_per_year"`
+		MaxInflationRate              Rational `json:"max_inflation_rate"`
+		ProtocolRewardRate            Rational `json:"protocol_reward_rate"`
+		OnlineMinThreshold            Rational `json:"online_min_threshold"`
+		OnlineMaxThreshold            Rational `json:"online_max_threshold"`
+	} `json:"result_EXPERIMENTAL_protocol_config"`
+}
+
+type BlockResult struct {
+	Block struct {
+		Author string `json:"author"`
+		Header struct {
+			Height                uint64 `json:"height"`
+			Hash                  string `json:"hash"`
+			PrevHash              string `json:"prev_hash"`
+			EpochId               string `json:"epoch_id"`
+			NextEpochId           string `json:"next_epoch_id"`
+			Timestamp             uint64 `json:"timestamp"`
+			LatestProtocolVersion int    `json:"latest_protocol_version"`
+			TotalSupply           string `json:"total_supply"`
+		} `json:"header"`
+		Chunks []struct {
+			ChunkHash      string `json:"chunk_hash"`
+			ShardId        int    `json:"shard_id"`
+			HeightIncluded uint64 `json:"height_included"`
+			GasUsed        uint64 `json:"gas_used"`
+			GasLimit       uint64 `json:"gas_limit"`
+		} `json:"chunks"`
+	} `json:"result_block"`
+}
+
+type NetworkInfoResult struct {
+	NetworkInfo struct {
+		ActivePeers []struct {
+			Id        string `json:"id"`
+			Addr      string `json:"addr"`
+			AccountId string `json:"account_id"`
+		} `json:"active_peers"`
+		NumActivePeers      int   `json:"num_active_peers"`
+		PeerMaxCount        int   `json:"peer_max_count"`
+		SentBytesPerSec     int64 `json:"sent_bytes_per_sec"`
+		ReceivedBytesPerSec int64 `json:"received_bytes_per_sec"`
+		KnownProducers      []struct {
+			AccountId string `json:"account_id"`
+			Addr      string `json:"addr"`
+			PeerId    string `json:"peer_id"`
+		} `json:"known_producers"`
+	} `json:"result_network_info"`
+}
+
+type GasPriceResult struct {
+	GasPrice struct {
+		GasPrice string `json:"gas_price"`
+	} `json:"result_gas_price"`
+}
+
+type ChunkResult struct {
+	Chunk struct {
+		Header struct {
+			GasUsed  uint64 `json:"gas_used"`
+			GasLimit uint64 `json:"gas_limit"`
+		} `json:"header"`
+		Transactions []json.RawMessage `json:"transactions"`
+	} `json:"result_chunk"`
+}
+
 type Result struct {
 	StatusResult
 	ValidatorsResult
 	QueryResult
+	ProtocolConfigResult
+	BlockResult
+	NetworkInfoResult
+	GasPriceResult
+	ChunkResult
+	// Error is the raw JSON-RPC error, GetContext returns it as *Error.
+	Error json.RawMessage `json:"error"`
+}
+
+// Error is a JSON-RPC error response, which GetContext returns as error.
+type Error struct {
+	Name  string `json:"name"`
+	Cause struct {
+		Name string `json:"name"`
+	} `json:"cause"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.Cause.Name != "" {
+		msg += ": " + e.Cause.Name
+	}
+	if e.Data != nil {
+		msg += fmt.Sprintf(": %v", e.Data)
+	}
+	return msg
 }
 
+// RPC calls NEAR JSON-RPC methods. The collectors depend on it instead of
+// Client, so that they can be run against a fake node, see package rpctest.
+type RPC interface {
+	Get(method string, variables interface{}) (*Result, error)
+	GetContext(ctx context.Context, method string, variables interface{}) (*Result, error)
+}
+
+const maxBackoff = 30 * time.Second
+
 type Client struct {
 	httpClient *http.Client
 	Endpoint   string
+	// Retries is the number of times a failed request is repeated.
+	Retries int
+	// Backoff is the delay before the first retry, it doubles with every
+	// further retry up to maxBackoff.
+	Backoff time.Duration
+	// Tracer records a span for every RPC call, nil disables tracing.
+	Tracer *tracing.Tracer
+	// Metrics records every RPC request, nil disables the metrics.
+	Metrics *Metrics
+	// Header is sent with every RPC request, e.g. the API key of a hosted RPC
+	// provider.
+	Header http.Header
+
+	sem chan struct{}
+
+	cacheDir     string
+	cacheMaxAge  time.Duration
+	cacheMethods map[string]bool
+	cacheMu      sync.Mutex
+	fallbacks    map[string]time.Time
+
+	rawMu   sync.Mutex
+	raw     map[string]string
+	dumpRaw bool
+
+	lastMu   sync.Mutex
+	lastDone bool
+	lastErr  error
+
+	responseTTL time.Duration
+	callsMu     sync.Mutex
+	calls       map[string]*sharedCall
 }
 
 func NewClient(endpoint string) *Client {
@@ -94,6 +268,28 @@ func NewClient(endpoint string) *Client {
 	}
 }
 
+// SetBearerToken authenticates every RPC request with the bearer token.
+func (c *Client) SetBearerToken(token string) {
+	c.setHeader("Authorization", "Bearer "+token)
+}
+
+// SetBasicAuth authenticates every RPC request with basic auth.
+func (c *Client) SetBasicAuth(user string, password string) {
+	c.setHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+}
+
+func (c *Client) setHeader(key string, value string) {
+	if c.Header == nil {
+		c.Header = make(http.Header)
+	}
+	c.Header.Set(key, value)
+}
+
+// SetTimeout sets the timeout of a single RPC request, retries excluded.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
 func NewClientWith(client *http.Client, endpoint string) *Client {
 	return &Client{
 		Endpoint:   endpoint,
@@ -101,7 +297,33 @@ func NewClientWith(client *http.Client, endpoint string) *Client {
 	}
 }
 
-func (c *Client) do(method string, params interface{}) (string, error) {
+// SetMaxConcurrency limits the number of requests in flight, 0 means no
+// limit. It must be called before the client is used.
+func (c *Client) SetMaxConcurrency(n int) {
+	c.sem = nil
+	if n > 0 {
+		c.sem = make(chan struct{}, n)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, params interface{}) (_ string, err error) {
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+			defer func() { <-c.sem }()
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	start := time.Now()
+	defer func() {
+		c.Metrics.observe(method, start, err)
+		c.lastMu.Lock()
+		c.lastDone, c.lastErr = true, err
+		c.lastMu.Unlock()
+		logging.Debug("RPC request", "method", method, "endpoint", c.Endpoint, "duration", time.Since(start), "err", err)
+	}()
+
 	payload, err := json.Marshal(map[string]string{
 		"query": method,
 	})
@@ -121,14 +343,18 @@ func (c *Client) do(method string, params interface{}) (string, error) {
 		}
 		payload, err = json.Marshal(p)
 		if err != nil {
-			log.Println(err)
+			return "", err
 		}
 	}
 	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewBuffer(payload))
-	req.Header.Set("Content-Type", "application/json")
 	if err != nil {
 		return "", err
 	}
+	req = req.WithContext(ctx)
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
 
 	r, err := c.httpClient.Do(req)
 	if err != nil {
@@ -139,12 +365,90 @@ func (c *Client) do(method string, params interface{}) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	c.recordRaw(method, body)
+	if r.StatusCode >= http.StatusInternalServerError {
+		return "", fmt.Errorf("%s: %s", method, r.Status)
+	}
 	return string(body), nil
 }
 
+// LastRequest reports whether a request was sent yet and the error of the
+// last one.
+func (c *Client) LastRequest() (bool, error) {
+	c.lastMu.Lock()
+	defer c.lastMu.Unlock()
+	return c.lastDone, c.lastErr
+}
+
+// EnableRawDump makes the client keep the last raw response body of every
+// RPC method, see RawResponses.
+func (c *Client) EnableRawDump() {
+	c.rawMu.Lock()
+	defer c.rawMu.Unlock()
+	c.dumpRaw = true
+	if c.raw == nil {
+		c.raw = make(map[string]string)
+	}
+}
+
+func (c *Client) recordRaw(method string, body []byte) {
+	c.rawMu.Lock()
+	defer c.rawMu.Unlock()
+	if c.dumpRaw {
+		c.raw[method] = string(body)
+	}
+}
+
+// RawResponses returns a copy of the last raw response body per RPC method.
+func (c *Client) RawResponses() map[string]string {
+	c.rawMu.Lock()
+	defer c.rawMu.Unlock()
+	res := make(map[string]string, len(c.raw))
+	for k, v := range c.raw {
+		res[k] = v
+	}
+	return res
+}
+
 func (c *Client) Get(method string, variables interface{}) (*Result, error) {
-	res, err := c.do(method, variables)
+	return c.GetContext(context.Background(), method, variables)
+}
+
+// GetContext calls an RPC method, giving up when ctx is done.
+func (c *Client) GetContext(ctx context.Context, method string, variables interface{}) (*Result, error) {
+	if c.responseTTL > 0 {
+		return c.sharedGet(ctx, method, variables)
+	}
+	return c.get(ctx, method, variables)
+}
+
+func (c *Client) get(ctx context.Context, method string, variables interface{}) (_ *Result, err error) {
+	span, ctx := c.Tracer.Start(ctx, "rpc "+method)
+	span.SetAttribute("rpc.method", method)
+	span.SetAttribute("rpc.endpoint", c.Endpoint)
+	defer func() { span.End(err) }()
+
+	res, err := c.do(ctx, method, variables)
+	backoff := c.Backoff
+	for attempt := 0; err != nil && attempt < c.Retries; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		res, err = c.do(ctx, method, variables)
+	}
+	if c.cacheMethods[method] {
+		var ok bool
+		if res, ok = c.cached(method, variables, res, err); ok {
+			err = nil
+		}
+	}
 	if err != nil {
+		logging.Warn("RPC request failed", "method", method, "endpoint", c.Endpoint, "err", err)
 		return nil, err
 	}
 	var d Result
@@ -152,8 +456,16 @@ func (c *Client) Get(method string, variables interface{}) (*Result, error) {
 	r := bytes.NewReader([]byte(res))
 	err2 := json.NewDecoder(r).Decode(&d)
 	if err2 != nil {
-		log.Println(err2)
+		logging.Error("decoding RPC response failed", "method", method, "err", err2)
 		return nil, err2
 	}
+	if len(d.Error) > 0 {
+		logging.Warn("RPC error", "method", method, "endpoint", c.Endpoint, "error", string(d.Error))
+		rpcErr := &Error{}
+		if err := json.Unmarshal(d.Error, rpcErr); err != nil {
+			return nil, fmt.Errorf("%s: %s", method, d.Error)
+		}
+		return nil, rpcErr
+	}
 	return &d, nil
 }
@@ -0,0 +1,112 @@
+package nearapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EnableDiskCache persists the last good response of the given methods in
+// dir. When a later call fails for reasons of the node, e.g. during an RPC
+// outage right after a restart, the persisted response is returned instead as long as it is not
+// older than maxAge (0 means no limit). It must be called before the client
+// is used.
+func (c *Client) EnableDiskCache(dir string, maxAge time.Duration, methods ...string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	c.cacheDir = dir
+	c.cacheMaxAge = maxAge
+	c.cacheMethods = make(map[string]bool)
+	for _, m := range methods {
+		c.cacheMethods[m] = true
+	}
+	c.fallbacks = make(map[string]time.Time)
+	return nil
+}
+
+// Fallbacks returns, per method, the time the disk cached response currently
+// served instead of a live one was stored.
+func (c *Client) Fallbacks() map[string]time.Time {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	res := make(map[string]time.Time, len(c.fallbacks))
+	for k, v := range c.fallbacks {
+		res[k] = v
+	}
+	return res
+}
+
+func (c *Client) cachePath(method string, params interface{}) string {
+	p, _ := json.Marshal(params)
+	sum := sha256.Sum256(append([]byte(method+"\x00"), p...))
+	return filepath.Join(c.cacheDir, method+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// serverErrorCauses are the causes of JSON-RPC errors of the node rather than
+// of the request.
+var serverErrorCauses = map[string]bool{"INTERNAL_ERROR": true, "TIMEOUT_ERROR": true, "NO_SYNCED_BLOCKS": true, "NOT_SYNCED_YET": true}
+
+// classifyResponse reports whether body is a successful JSON-RPC response,
+// and whether it failed for reasons of the node, e.g. a timeout, or is no
+// JSON-RPC response at all. Errors of the request, e.g. an unknown account
+// or block, are neither.
+func classifyResponse(body string) (good bool, failed bool) {
+	var r struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		return false, true
+	}
+	if len(r.Error) == 0 {
+		return len(r.Result) > 0, len(r.Result) == 0
+	}
+	var e Error
+	if err := json.Unmarshal(r.Error, &e); err != nil {
+		return false, true
+	}
+	return false, e.Name == "INTERNAL_ERROR" || serverErrorCauses[e.Cause.Name]
+}
+
+// cached stores body when it is good, or returns the cached response when
+// the call failed for reasons of the node: a transport error, a 5xx response
+// or a server error of the node. Errors of the request are passed through.
+// The boolean result reports whether a response is available.
+func (c *Client) cached(method string, params interface{}, body string, err error) (string, bool) {
+	path := c.cachePath(method, params)
+	good, failed := false, true
+	if err == nil {
+		good, failed = classifyResponse(body)
+	}
+	if good {
+		tmp := path + ".tmp"
+		if werr := ioutil.WriteFile(tmp, []byte(body), 0600); werr == nil {
+			os.Rename(tmp, path)
+		}
+		c.cacheMu.Lock()
+		delete(c.fallbacks, method)
+		c.cacheMu.Unlock()
+		return body, true
+	}
+	if !failed {
+		return body, true
+	}
+
+	info, serr := os.Stat(path)
+	if serr != nil || (c.cacheMaxAge > 0 && time.Since(info.ModTime()) > c.cacheMaxAge) {
+		return body, err == nil
+	}
+	data, rerr := ioutil.ReadFile(path)
+	if rerr != nil {
+		return body, err == nil
+	}
+	c.cacheMu.Lock()
+	c.fallbacks[method] = info.ModTime()
+	c.cacheMu.Unlock()
+	return string(data), true
+}
@@ -0,0 +1,70 @@
+package nearapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+const validatorsResponse = `{"jsonrpc":"2.0","id":"dontcare","result":{"epoch_height":100}}`
+
+func TestDiskCacheFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantFallback bool
+	}{
+		{name: "5xx", status: http.StatusBadGateway, body: "bad gateway", wantFallback: true},
+		{name: "no JSON", status: http.StatusOK, body: "<html>maintenance</html>", wantFallback: true},
+		{name: "internal error", status: http.StatusOK, body: `{"error":{"name":"INTERNAL_ERROR","cause":{"name":"INTERNAL_ERROR"},"code":-32000,"message":"Server error"}}`, wantFallback: true},
+		{name: "timeout", status: http.StatusRequestTimeout, body: `{"error":{"name":"HANDLER_ERROR","cause":{"name":"TIMEOUT_ERROR"},"code":-32000,"message":"Server error"}}`, wantFallback: true},
+		{name: "unknown block", status: http.StatusOK, body: `{"error":{"name":"HANDLER_ERROR","cause":{"name":"UNKNOWN_BLOCK"},"code":-32000,"message":"Server error","data":"DB Not Found Error"}}`},
+		{name: "unknown account", status: http.StatusOK, body: `{"error":{"name":"HANDLER_ERROR","cause":{"name":"UNKNOWN_ACCOUNT"},"code":-32000,"message":"Server error"}}`},
+		{name: "invalid params", status: http.StatusBadRequest, body: `{"error":{"name":"REQUEST_VALIDATION_ERROR","cause":{"name":"PARSE_ERROR"},"code":-32700,"message":"Parse error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			status, body := http.StatusOK, validatorsResponse
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				w.WriteHeader(status)
+				w.Write([]byte(body))
+			}))
+			defer srv.Close()
+			dir, err := ioutil.TempDir("", "cache")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			c := NewClient(srv.URL)
+			if err := c.EnableDiskCache(dir, 0, "validators"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Get("validators", "latest"); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			status, body = tt.status, tt.body
+			mu.Unlock()
+
+			r, err := c.Get("validators", "latest")
+			_, fellBack := c.Fallbacks()["validators"]
+			if fellBack != tt.wantFallback {
+				t.Errorf("fell back %v, want %v", fellBack, tt.wantFallback)
+			}
+			if tt.wantFallback && (err != nil || r.Validators.EpochHeight != 100) {
+				t.Errorf("got %+v, %v, want the cached response", r, err)
+			}
+			if !tt.wantFallback && err == nil {
+				t.Error("want the error of the request")
+			}
+		})
+	}
+}
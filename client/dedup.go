@@ -0,0 +1,90 @@
+package nearapi
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type sharedCall struct {
+	done chan struct{}
+	at   time.Time
+	res  *Result
+	err  error
+}
+
+// EnableResponseCache makes concurrent identical calls share one request and
+// reuses successful responses for ttl, so that collectors asking for the
+// same status or validators within a scrape cause a single request. Failed
+// calls, JSON-RPC errors included, are not reused. It must be called before
+// the client is used.
+func (c *Client) EnableResponseCache(ttl time.Duration) {
+	c.responseTTL = ttl
+	c.calls = make(map[string]*sharedCall)
+}
+
+func (c *Client) sharedGet(ctx context.Context, method string, params interface{}) (*Result, error) {
+	p, _ := json.Marshal(params)
+	key := method + "\x00" + string(p)
+
+	c.callsMu.Lock()
+	if sc, ok := c.calls[key]; ok {
+		select {
+		case <-sc.done:
+			if sc.err == nil && time.Since(sc.at) < c.responseTTL {
+				c.callsMu.Unlock()
+				c.Metrics.cacheHit(method)
+				return sc.res, nil
+			}
+		default:
+			c.callsMu.Unlock()
+			c.Metrics.cacheHit(method)
+			return sc.wait(ctx)
+		}
+	}
+	for k, sc := range c.calls {
+		select {
+		case <-sc.done:
+			if time.Since(sc.at) >= c.responseTTL {
+				delete(c.calls, k)
+			}
+		default:
+		}
+	}
+	sc := &sharedCall{done: make(chan struct{})}
+	c.calls[key] = sc
+	c.callsMu.Unlock()
+
+	// The call is shared, so it must not be aborted when the context of the
+	// caller which happened to start it is done. The client timeout bounds
+	// it.
+	c.Metrics.cacheMiss(method)
+	go func() {
+		sc.res, sc.err = c.get(detachedContext{ctx}, method, params)
+		sc.at = time.Now()
+		close(sc.done)
+	}()
+	return sc.wait(ctx)
+}
+
+// wait returns the result of the call, or the error of ctx if it is done
+// first.
+func (sc *sharedCall) wait(ctx context.Context) (*Result, error) {
+	select {
+	case <-sc.done:
+		return sc.res, sc.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// detachedContext carries the values of a context, e.g. the trace span,
+// without its deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,173 @@
+package nearapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const statusResponse = `{"jsonrpc":"2.0","id":"dontcare","result":{"chain_id":"testnet"}}`
+
+// blockingServer answers every request with body once release is closed,
+// or at once if it is nil, and counts the requests.
+type blockingServer struct {
+	release  chan struct{}
+	status   int
+	body     string
+	requests int32
+}
+
+func (s *blockingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	if s.release != nil {
+		<-s.release
+	}
+	w.WriteHeader(s.status)
+	w.Write([]byte(s.body))
+}
+
+func (s *blockingServer) Requests() int {
+	return int(atomic.LoadInt32(&s.requests))
+}
+
+// waitFor polls cond until it is true or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestResponseCacheSharesCalls(t *testing.T) {
+	s := &blockingServer{release: make(chan struct{}), status: http.StatusOK, body: statusResponse}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := NewClient(srv.URL)
+	c.Metrics = NewMetrics()
+	c.EnableResponseCache(100 * time.Millisecond)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	call := func() {
+		defer wg.Done()
+		r, err := c.Get("status", nil)
+		if err == nil && r.Status.ChainId != "testnet" {
+			t.Errorf("got chain %q", r.Status.ChainId)
+		}
+		errs <- err
+	}
+	wg.Add(1)
+	go call()
+	waitFor(t, "the first request", func() bool { return s.Requests() == 1 })
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go call()
+	}
+	// The other callers wait for the call in flight.
+	waitFor(t, "the callers to join", func() bool { return testutil.ToFloat64(c.Metrics.hits.WithLabelValues("status")) == callers-1 })
+	close(s.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Requests() != 1 {
+		t.Fatalf("got %d requests for concurrent calls, want 1", s.Requests())
+	}
+
+	// The response is reused for the ttl, then requested again.
+	if _, err := c.Get("status", nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.Requests() != 1 {
+		t.Fatalf("got %d requests within the ttl, want 1", s.Requests())
+	}
+	// Other params are another call.
+	if _, err := c.Get("status", []string{"x"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Requests() != 2 {
+		t.Fatalf("got %d requests for other params, want 2", s.Requests())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Get("status", nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.Requests() != 3 {
+		t.Fatalf("got %d requests after the ttl, want 3", s.Requests())
+	}
+}
+
+func TestResponseCacheFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "HTTP error", status: http.StatusBadGateway, body: "bad gateway"},
+		{name: "JSON-RPC error", status: http.StatusOK, body: `{"jsonrpc":"2.0","id":"dontcare","error":{"name":"HANDLER_ERROR","cause":{"name":"UNKNOWN_BLOCK"},"code":-32000,"message":"Server error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &blockingServer{status: tt.status, body: tt.body}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			c := NewClient(srv.URL)
+			c.EnableResponseCache(time.Minute)
+
+			for i := 1; i <= 2; i++ {
+				if _, err := c.Get("block", map[string]string{"finality": "final"}); err == nil {
+					t.Fatal("want an error")
+				}
+				if s.Requests() != i {
+					t.Fatalf("got %d requests, want %d: failed calls must not be reused", s.Requests(), i)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCacheDetachedCall(t *testing.T) {
+	s := &blockingServer{release: make(chan struct{}), status: http.StatusOK, body: statusResponse}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := NewClient(srv.URL)
+	c.EnableResponseCache(time.Minute)
+
+	// The caller which starts the call gives up, the call goes on for the
+	// other callers.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.GetContext(ctx, "status", nil)
+		first <- err
+	}()
+	waitFor(t, "the first request", func() bool { return s.Requests() == 1 })
+	second := make(chan error, 1)
+	go func() {
+		_, err := c.Get("status", nil)
+		second <- err
+	}()
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("got error %v for the cancelled caller, want %v", err, context.Canceled)
+	}
+	close(s.release)
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	if s.Requests() != 1 {
+		t.Fatalf("got %d requests, want 1", s.Requests())
+	}
+}
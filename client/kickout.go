@@ -0,0 +1,40 @@
+package nearapi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// KickoutReason is the reason a validator was kicked out in the previous
+// epoch. It is encoded either as a string, e.g. "Slashed", or as an object
+// with the reason as its only key, e.g. {"NotEnoughBlocks": {...}}.
+type KickoutReason struct {
+	Name     string
+	Produced int64
+	Expected int64
+	// Stake and Threshold are set for NotEnoughStake, in yoctoNEAR.
+	Stake     string
+	Threshold string
+}
+
+func (r *KickoutReason) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Name); err == nil {
+		return nil
+	}
+	var m map[string]struct {
+		Produced  int64  `json:"produced"`
+		Expected  int64  `json:"expected"`
+		Stake     string `json:"stake_u128"`
+		Threshold string `json:"threshold_u128"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if len(m) != 1 {
+		return fmt.Errorf("invalid kickout reason %s", data)
+	}
+	for name, d := range m {
+		r.Name, r.Produced, r.Expected, r.Stake, r.Threshold = name, d.Produced, d.Expected, d.Stake, d.Threshold
+	}
+	return nil
+}
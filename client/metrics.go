@@ -0,0 +1,82 @@
+package nearapi
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics counts the RPC requests of the clients it is assigned to. It is a
+// prometheus.Collector, a nil *Metrics records nothing.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	hits     *prometheus.CounterVec
+	misses   *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "near_exporter_rpc_requests_total",
+			Help: "The number of RPC requests sent, retries included",
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "near_exporter_rpc_errors_total",
+			Help: "The number of RPC requests which failed",
+		}, []string{"method"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "near_exporter_rpc_request_duration_seconds",
+			Help:    "Duration of RPC requests",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "near_exporter_rpc_cache_hits_total",
+			Help: "The number of RPC calls served by a cached or in-flight identical call",
+		}, []string{"method"}),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "near_exporter_rpc_cache_misses_total",
+			Help: "The number of RPC calls not found in the response cache",
+		}, []string{"method"}),
+	}
+}
+
+func (m *Metrics) observe(method string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(method).Inc()
+	m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *Metrics) cacheHit(method string) {
+	if m != nil {
+		m.hits.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *Metrics) cacheMiss(method string) {
+	if m != nil {
+		m.misses.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+	m.hits.Describe(ch)
+	m.misses.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+	m.hits.Collect(ch)
+	m.misses.Collect(ch)
+}
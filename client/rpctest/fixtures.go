@@ -0,0 +1,220 @@
+package rpctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The fixtures describe a testnet where ValidatorId, running a staking pool,
+// and OtherValidatorId are the current validators. They stake 40% of the
+// total supply of 50000 NEAR.
+const (
+	ChainId          = "testnet"
+	ValidatorId      = "validator.test"
+	ValidatorKey     = "ed25519:6DSjZ8mvsRZDvFqFxo8tCKePG96omXW7eVYVSySmDk8e"
+	OtherValidatorId = "other.test"
+	OwnerId          = "owner.test"
+	WhitelistId      = "whitelist.near"
+	BlockHeight      = 1000000
+	EpochHeight      = 100
+	EpochLength      = 43200
+	ProtocolVersion  = 60
+	// BlockTime is the time between the fixture blocks in nanoseconds.
+	BlockTime = 1200000000
+)
+
+// Delegator is an account of the staking pool on ValidatorId.
+type Delegator struct {
+	AccountId       string `json:"account_id"`
+	UnstakedBalance string `json:"unstaked_balance"`
+	StakedBalance   string `json:"staked_balance"`
+	CanWithdraw     bool   `json:"can_withdraw"`
+}
+
+// Delegators are the accounts of the staking pool on ValidatorId, staking
+// 1000, 2000 and 3000 NEAR.
+var Delegators = []Delegator{
+	{"alice.test", "0", "1000000000000000000000000000", false},
+	{"bob.test", "500000000000000000000000000", "2000000000000000000000000000", true},
+	{"carol.test", "0", "3000000000000000000000000000", false},
+}
+
+func blockHash(height int64) string {
+	return fmt.Sprintf("block%d", height)
+}
+
+func (n *Node) installFixtures() {
+	n.SetResult("status", map[string]interface{}{
+		"version":                 map[string]string{"version": "1.0.0", "build": "rpctest"},
+		"chain_id":                ChainId,
+		"genesis_hash":            "GenesisHash111111111111111111111111111111111",
+		"protocol_version":        ProtocolVersion,
+		"latest_protocol_version": ProtocolVersion,
+		"rpc_addr":                "0.0.0.0:3030",
+		"validator_account_id":    ValidatorId,
+		"validator_public_key":    ValidatorKey,
+		"sync_info": map[string]interface{}{
+			"latest_block_hash":   blockHash(BlockHeight),
+			"latest_block_height": BlockHeight,
+			"latest_state_root":   "StateRoot",
+			"latest_block_time":   "2020-09-13T12:26:40.000000000Z",
+			"syncing":             false,
+		},
+	})
+	n.SetResult("validators", map[string]interface{}{
+		"current_validators": []map[string]interface{}{
+			{
+				"account_id":          ValidatorId,
+				"public_key":          ValidatorKey,
+				"stake":               "6000000000000000000000000000",
+				"is_slashed":          false,
+				"shards":              []int{0},
+				"num_produced_blocks": 95,
+				"num_expected_blocks": 100,
+				"num_produced_chunks": 380,
+				"num_expected_chunks": 400,
+			},
+			{
+				"account_id":          OtherValidatorId,
+				"public_key":          "ed25519:Other",
+				"stake":               "14000000000000000000000000000",
+				"is_slashed":          false,
+				"shards":              []int{0},
+				"num_produced_blocks": 230,
+				"num_expected_blocks": 233,
+				"num_produced_chunks": 900,
+				"num_expected_chunks": 932,
+			},
+		},
+		"next_validators": []map[string]interface{}{
+			{"account_id": ValidatorId, "public_key": ValidatorKey, "stake": "6000000000000000000000000000", "shards": []int{0}},
+			{"account_id": OtherValidatorId, "public_key": "ed25519:Other", "stake": "14000000000000000000000000000", "shards": []int{0}},
+		},
+		"current_proposals": []map[string]interface{}{
+			{"account_id": ValidatorId, "public_key": ValidatorKey, "stake": "6500000000000000000000000000"},
+		},
+		"epoch_height":       EpochHeight,
+		"epoch_start_height": BlockHeight - 1000,
+		"prev_epoch_kickout": []map[string]interface{}{
+			{"account_id": "kicked.test", "reason": map[string]interface{}{"NotEnoughBlocks": map[string]int{"produced": 10, "expected": 100}}},
+		},
+	})
+	n.SetResult("EXPERIMENTAL_protocol_config", map[string]interface{}{
+		"protocol_version":                   ProtocolVersion,
+		"chain_id":                           ChainId,
+		"epoch_length":                       EpochLength,
+		"num_block_producer_seats":           100,
+		"num_block_producer_seats_per_shard": []int{100},
+		"num_chunk_only_producer_seats":      200,
+		"block_producer_kickout_threshold":   90,
+		"chunk_producer_kickout_threshold":   90,
+		"num_blocks_per_year":                31536000,
+		"max_inflation_rate":                 []int{1, 20},
+		"protocol_reward_rate":               []int{1, 10},
+		"online_min_threshold":               []int{9, 10},
+		"online_max_threshold":               []int{99, 100},
+	})
+	n.Handle("block", blockFixture)
+	n.SetResult("chunk", map[string]interface{}{
+		"header":       map[string]int{"gas_used": 1000000, "gas_limit": 1000000000000000},
+		"transactions": []map[string]string{{"hash": "tx1"}, {"hash": "tx2"}},
+		"receipts":     []interface{}{},
+	})
+	n.SetResult("gas_price", map[string]string{"gas_price": "100000000"})
+	n.SetResult("network_info", map[string]interface{}{
+		"active_peers": []map[string]interface{}{
+			{"id": "ed25519:Peer1", "addr": "10.0.0.1:24567", "account_id": OtherValidatorId},
+			{"id": "ed25519:Peer2", "addr": "10.0.0.2:24567", "account_id": nil},
+		},
+		"num_active_peers":       2,
+		"peer_max_count":         40,
+		"sent_bytes_per_sec":     1000,
+		"received_bytes_per_sec": 2000,
+		"known_producers": []map[string]interface{}{
+			{"account_id": OtherValidatorId, "addr": "10.0.0.1:24567", "peer_id": "ed25519:Peer1"},
+		},
+	})
+
+	n.SetAccount(ValidatorId, map[string]interface{}{
+		"amount":        "25000000000000000000000000",
+		"locked":        "6000000000000000000000000000",
+		"code_hash":     "J1arLz48fgXcGyCPVckFwLnewNH6j1uw79thsvwqGYTY",
+		"storage_usage": 182000,
+		"block_height":  BlockHeight,
+		"block_hash":    blockHash(BlockHeight),
+	})
+	n.SetView(ValidatorId, "get_reward_fee_fraction", map[string]int{"numerator": 10, "denominator": 100})
+	n.SetView(ValidatorId, "get_total_staked_balance", "6000000000000000000000000000")
+	n.SetView(ValidatorId, "get_owner_id", OwnerId)
+	n.SetView(ValidatorId, "get_number_of_accounts", len(Delegators))
+	n.SetView(WhitelistId, "is_whitelisted", true)
+	n.HandleView(ValidatorId, "get_accounts", func(args json.RawMessage) (interface{}, error) {
+		var page struct {
+			FromIndex int `json:"from_index"`
+			Limit     int `json:"limit"`
+		}
+		if err := json.Unmarshal(args, &page); err != nil {
+			return nil, err
+		}
+		res := []Delegator{}
+		for i := page.FromIndex; i < len(Delegators) && i < page.FromIndex+page.Limit; i++ {
+			res = append(res, Delegators[i])
+		}
+		return res, nil
+	})
+	n.HandleView(ValidatorId, "get_account", func(args json.RawMessage) (interface{}, error) {
+		var a struct {
+			AccountId string `json:"account_id"`
+		}
+		if err := json.Unmarshal(args, &a); err != nil {
+			return nil, err
+		}
+		for _, d := range Delegators {
+			if d.AccountId == a.AccountId {
+				return d, nil
+			}
+		}
+		return Delegator{AccountId: a.AccountId, UnstakedBalance: "0", StakedBalance: "0", CanWithdraw: true}, nil
+	})
+}
+
+// blockFixture returns the block at the block_id given by height or hash,
+// or at BlockHeight for a finality. Every block has one new chunk.
+func blockFixture(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		BlockId interface{} `json:"block_id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	height := int64(BlockHeight)
+	switch id := p.BlockId.(type) {
+	case float64:
+		height = int64(id)
+	case string:
+		h, err := strconv.ParseInt(strings.TrimPrefix(id, "block"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("block %s not found", id)
+		}
+		height = h
+	}
+	return map[string]interface{}{
+		"author": ValidatorId,
+		"header": map[string]interface{}{
+			"height":                  height,
+			"hash":                    blockHash(height),
+			"prev_hash":               blockHash(height - 1),
+			"epoch_id":                "Epoch100",
+			"next_epoch_id":           "Epoch101",
+			"timestamp":               1600000000000000000 + height*BlockTime,
+			"latest_protocol_version": ProtocolVersion,
+			"gas_price":               "100000000",
+			"total_supply":            "50000000000000000000000000000",
+		},
+		"chunks": []map[string]interface{}{
+			{"chunk_hash": fmt.Sprintf("chunk%d", height), "shard_id": 0, "height_included": height, "gas_used": 1000000, "gas_limit": 1000000000000000},
+		},
+	}, nil
+}
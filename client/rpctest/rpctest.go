@@ -0,0 +1,236 @@
+// Package rpctest provides a fake NEAR node answering JSON-RPC requests with
+// canned responses, to run the collectors without a node.
+package rpctest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Handler computes the result of an RPC method or view function from the
+// raw params or args of the call.
+type Handler func(params json.RawMessage) (interface{}, error)
+
+// Node is a fake NEAR node. NewNode serves the fixtures of this package,
+// which can be replaced per method with SetResult, Handle and Fail.
+type Node struct {
+	mu       sync.Mutex
+	methods  map[string]Handler
+	views    map[string]Handler
+	accounts map[string]interface{}
+	failures map[string]int
+	calls    map[string]int
+}
+
+// NewNode creates a node serving the fixtures: a validator ValidatorId
+// running a staking pool with Delegators, at block height BlockHeight.
+func NewNode() *Node {
+	n := &Node{
+		methods:  make(map[string]Handler),
+		views:    make(map[string]Handler),
+		accounts: make(map[string]interface{}),
+		failures: make(map[string]int),
+		calls:    make(map[string]int),
+	}
+	n.installFixtures()
+	return n
+}
+
+// NewServer starts an HTTP server serving n, the RPC URL is its URL field.
+func NewServer(n *Node) *httptest.Server {
+	return httptest.NewServer(n)
+}
+
+// SetResult makes the RPC method return result.
+func (n *Node) SetResult(method string, result interface{}) {
+	n.Handle(method, func(json.RawMessage) (interface{}, error) { return result, nil })
+}
+
+// Handle makes h compute the results of the RPC method.
+func (n *Node) Handle(method string, h Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.methods[method] = h
+	delete(n.failures, method)
+}
+
+// Fail makes the RPC method respond with the HTTP status, e.g. 500, 0 makes
+// it respond normally again.
+func (n *Node) Fail(method string, status int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if status == 0 {
+		delete(n.failures, method)
+		return
+	}
+	n.failures[method] = status
+}
+
+// SetView makes the view function method of the contract on accountId
+// return result.
+func (n *Node) SetView(accountId string, method string, result interface{}) {
+	n.HandleView(accountId, method, func(json.RawMessage) (interface{}, error) { return result, nil })
+}
+
+// HandleView makes h compute the results of the view function method of the
+// contract on accountId from its JSON args.
+func (n *Node) HandleView(accountId string, method string, h Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.views[accountId+"/"+method] = h
+}
+
+// SetAccount makes view_account queries of accountId return account.
+func (n *Node) SetAccount(accountId string, account interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.accounts[accountId] = account
+}
+
+// Calls returns the number of requests of the RPC method received.
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+type request struct {
+	Id     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcCause struct {
+	Name string `json:"name"`
+}
+
+type rpcError struct {
+	Name    string    `json:"name,omitempty"`
+	Cause   *rpcCause `json:"cause,omitempty"`
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    string    `json:"data"`
+}
+
+// unknownAccountError is the error of queries of accounts without account
+// and views, which the node reports as UNKNOWN_ACCOUNT.
+type unknownAccountError string
+
+func (e unknownAccountError) Error() string {
+	return fmt.Sprintf("account %s does not exist while viewing", string(e))
+}
+
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	n.calls[req.Method]++
+	status := n.failures[req.Method]
+	n.mu.Unlock()
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	res := map[string]interface{}{"jsonrpc": "2.0", "id": req.Id}
+	if result, err := n.call(req.Method, req.Params); err != nil {
+		rpcErr := rpcError{Code: -32000, Message: "Server error", Data: err.Error()}
+		if _, ok := err.(unknownAccountError); ok {
+			rpcErr.Name = "HANDLER_ERROR"
+			rpcErr.Cause = &rpcCause{"UNKNOWN_ACCOUNT"}
+		}
+		res["error"] = rpcErr
+	} else {
+		res["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (n *Node) call(method string, params json.RawMessage) (interface{}, error) {
+	if method == "query" {
+		return n.query(params)
+	}
+	n.mu.Lock()
+	h, ok := n.methods[method]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown method %s", method)
+	}
+	return h(params)
+}
+
+func (n *Node) query(params json.RawMessage) (interface{}, error) {
+	var q struct {
+		RequestType string `json:"request_type"`
+		AccountId   string `json:"account_id"`
+		MethodName  string `json:"method_name"`
+		ArgsBase64  string `json:"args_base64"`
+	}
+	if err := json.Unmarshal(params, &q); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	account, accountOk := n.accounts[q.AccountId]
+	view, viewOk := n.views[q.AccountId+"/"+q.MethodName]
+	exists := accountOk
+	for key := range n.views {
+		exists = exists || strings.HasPrefix(key, q.AccountId+"/")
+	}
+	n.mu.Unlock()
+	if !exists {
+		return nil, unknownAccountError(q.AccountId)
+	}
+
+	switch q.RequestType {
+	case "view_account":
+		if !accountOk {
+			return nil, unknownAccountError(q.AccountId)
+		}
+		return account, nil
+	case "call_function":
+		if !viewOk {
+			return nil, fmt.Errorf("method %s not found on %s", q.MethodName, q.AccountId)
+		}
+		args, err := base64.StdEncoding.DecodeString(q.ArgsBase64)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			args = []byte("{}")
+		}
+		v, err := view(args)
+		if err != nil {
+			return nil, err
+		}
+		return callResult(v)
+	}
+	return nil, fmt.Errorf("unsupported request type %s", q.RequestType)
+}
+
+// callResult encodes v like the result of a view function call, as the
+// bytes of its JSON encoding.
+func callResult(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	bytes := make([]int, len(b))
+	for i, c := range b {
+		bytes[i] = int(c)
+	}
+	return map[string]interface{}{
+		"block_hash":   blockHash(BlockHeight),
+		"block_height": BlockHeight,
+		"logs":         []string{},
+		"result":       bytes,
+	}, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/tracing"
+)
+
+// clientConfig is the configuration of the RPC clients, read from the flags
+// by every build, so that clients created later, e.g. for targets, neither
+// read the flags a reload changes nor miss any of the options.
+type clientConfig struct {
+	timeout           time.Duration
+	retries           int
+	backoff           time.Duration
+	cacheTTL          time.Duration
+	header            http.Header
+	basicAuthUser     string
+	basicAuthPassword string
+	bearerToken       string
+	tracer            *tracing.Tracer
+	metrics           *nearapi.Metrics
+}
+
+func (c clientConfig) newClient(endpoint string) *nearapi.Client {
+	client := nearapi.NewClient(endpoint)
+	client.SetTimeout(c.timeout)
+	client.Retries = c.retries
+	client.Backoff = c.backoff
+	if c.cacheTTL > 0 {
+		client.EnableResponseCache(c.cacheTTL)
+	}
+	client.Tracer = c.tracer
+	client.Metrics = c.metrics
+	client.Header = c.header.Clone()
+	if c.basicAuthUser != "" {
+		client.SetBasicAuth(c.basicAuthUser, c.basicAuthPassword)
+	}
+	if c.bearerToken != "" {
+		client.SetBearerToken(c.bearerToken)
+	}
+	return client
+}
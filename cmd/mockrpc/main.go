@@ -0,0 +1,24 @@
+// Command mockrpc serves the fake NEAR node of package rpctest, to run the
+// exporter and dashboards against without a node:
+//
+//	go run ./cmd/mockrpc -addr :3030
+//	near_exporter --near.rpc-url http://localhost:3030 --near.account-id validator.test
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+)
+
+func main() {
+	addr := flag.String("addr", ":3030", "listen address")
+	flag.Parse()
+
+	logging.Info("serving fake NEAR node", "addr", *addr, "account_id", rpctest.ValidatorId)
+	if err := http.ListenAndServe(*addr, rpctest.NewNode()); err != nil {
+		logging.Fatal("listen failed", "err", err)
+	}
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"context"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AccountBalanceMetrics exports the balances of arbitrary accounts, e.g. the
+// account whose key signs the staking proposals.
+type AccountBalanceMetrics struct {
+	client           nearapi.RPC
+	settings         Settings
+	accountIds       []string
+	blockId          string
+	amountDesc       *prometheus.Desc
+	lockedDesc       *prometheus.Desc
+	storageUsageDesc *prometheus.Desc
+	amountYoctoDesc  *prometheus.Desc
+	lockedYoctoDesc  *prometheus.Desc
+}
+
+func NewAccountBalanceMetrics(client nearapi.RPC, accountIds []string, blockId string, settings Settings) *AccountBalanceMetrics {
+	return &AccountBalanceMetrics{
+		client:     client,
+		settings:   settings,
+		accountIds: accountIds,
+		blockId:    blockId,
+		amountDesc: prometheus.NewDesc(
+			"near_account_amount",
+			"Liquid balance of a given account id",
+			[]string{"account_id"},
+			nil,
+		),
+		lockedDesc: prometheus.NewDesc(
+			"near_account_locked",
+			"Locked balance of a given account id",
+			[]string{"account_id"},
+			nil,
+		),
+		amountYoctoDesc: yoctoDesc("near_account_amount", "Liquid balance of a given account id", []string{"account_id"}),
+		lockedYoctoDesc: yoctoDesc("near_account_locked", "Locked balance of a given account id", []string{"account_id"}),
+		storageUsageDesc: prometheus.NewDesc(
+			"near_account_storage_usage",
+			"Storage used by a given account id in bytes",
+			[]string{"account_id"},
+			nil,
+		),
+	}
+}
+
+func (collector *AccountBalanceMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.amountDesc
+	ch <- collector.lockedDesc
+	ch <- collector.storageUsageDesc
+	if collector.settings.RawYocto {
+		ch <- collector.amountYoctoDesc
+		ch <- collector.lockedYoctoDesc
+	}
+}
+
+func (collector *AccountBalanceMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *AccountBalanceMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	for _, accountId := range collector.accountIds {
+		r, err := collector.client.GetContext(ctx, "query", withBlockRef(map[string]interface{}{"request_type": "view_account",
+			"account_id": accountId}, collector.blockId))
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(collector.amountDesc, err)
+			ch <- prometheus.NewInvalidMetric(collector.lockedDesc, err)
+			ch <- prometheus.NewInvalidMetric(collector.storageUsageDesc, err)
+			continue
+		}
+		account := r.Result
+		ch <- prometheus.MustNewConstMetric(collector.amountDesc, prometheus.GaugeValue, collector.settings.amount(account.Amount), accountId)
+		ch <- prometheus.MustNewConstMetric(collector.lockedDesc, prometheus.GaugeValue, collector.settings.amount(account.Locked), accountId)
+		ch <- prometheus.MustNewConstMetric(collector.storageUsageDesc, prometheus.GaugeValue, float64(account.StorageUsage), accountId)
+		if collector.settings.RawYocto {
+			ch <- mustNewYoctoMetric(collector.amountYoctoDesc, account.Amount, accountId)
+			ch <- mustNewYoctoMetric(collector.lockedYoctoDesc, account.Locked, accountId)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type poolEntry struct {
+	stake      string
+	fetched    time.Time
+	delegators int
+	delegated  float64
+}
+
+// AllPoolsMetrics exports delegator aggregates of every current validator.
+// Querying the delegator lists of all pools on each scrape would overload the
+// RPC, so the results are cached and at most batchSize pools are re-queried
+// per scrape. A pool is only re-queried once its stake has changed, or when
+// maxAge is set and half of it has passed. Entries older than maxAge are not
+// exported.
+type AllPoolsMetrics struct {
+	client    nearapi.RPC
+	settings  Settings
+	blockId   string
+	batchSize int
+	maxAge    time.Duration
+
+	mu    sync.Mutex
+	pools map[string]*poolEntry
+	last  string
+
+	poolDelegatorsDesc     *prometheus.Desc
+	poolDelegatedStakeDesc *prometheus.Desc
+	pendingPoolsDesc       *prometheus.Desc
+	suppressedPoolsDesc    *prometheus.Desc
+}
+
+func NewAllPoolsMetrics(client nearapi.RPC, blockId string, batchSize int, maxAge time.Duration, settings Settings) *AllPoolsMetrics {
+	return &AllPoolsMetrics{
+		client:    client,
+		settings:  settings,
+		blockId:   blockId,
+		batchSize: batchSize,
+		maxAge:    maxAge,
+		pools:     make(map[string]*poolEntry),
+		poolDelegatorsDesc: prometheus.NewDesc(
+			"near_pool_delegators",
+			"The number of delegators of a staking pool",
+			[]string{"account_id"},
+			nil,
+		),
+		poolDelegatedStakeDesc: prometheus.NewDesc(
+			"near_pool_delegated_stake",
+			"The sum of delegators stake of a staking pool",
+			[]string{"account_id"},
+			nil,
+		),
+		pendingPoolsDesc: prometheus.NewDesc(
+			"near_all_pools_pending_refresh",
+			"The number of pools waiting to be re-queried",
+			nil,
+			nil,
+		),
+		suppressedPoolsDesc: prometheus.NewDesc(
+			"near_all_pools_suppressed",
+			"The number of pools not exported because their cached values exceeded the max age",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *AllPoolsMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.poolDelegatorsDesc
+	ch <- collector.poolDelegatedStakeDesc
+	ch <- collector.pendingPoolsDesc
+	ch <- collector.suppressedPoolsDesc
+}
+
+func (collector *AllPoolsMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *AllPoolsMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var validatorsParams interface{} = "latest"
+	if collector.blockId != "" {
+		validatorsParams = []interface{}{BlockId(collector.blockId)}
+	}
+	r, err := collector.client.GetContext(ctx, "validators", validatorsParams)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.poolDelegatorsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.poolDelegatedStakeDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.pendingPoolsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.suppressedPoolsDesc, err)
+		return
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	stakes := make(map[string]string)
+	for _, v := range r.Validators.CurrentValidators {
+		stakes[v.AccountId] = v.Stake
+	}
+	for accountId := range collector.pools {
+		if _, ok := stakes[accountId]; !ok {
+			delete(collector.pools, accountId)
+		}
+	}
+
+	var stale []string
+	for accountId, stake := range stakes {
+		e, ok := collector.pools[accountId]
+		if !ok || e.stake != stake || (collector.maxAge > 0 && time.Since(e.fetched) >= collector.maxAge/2) {
+			stale = append(stale, accountId)
+		}
+	}
+	sort.Strings(stale)
+
+	// Continue after the last refreshed pool so that pools failing to
+	// respond don't starve the rest of the queue.
+	start := sort.SearchStrings(stale, collector.last)
+	if start < len(stale) && stale[start] == collector.last {
+		start++
+	}
+	stale = append(stale[start:], stale[:start]...)
+
+	refreshed := 0
+	for _, accountId := range stale {
+		if refreshed >= collector.batchSize {
+			break
+		}
+		refreshed++
+		collector.last = accountId
+		if e, err := collector.fetchPool(ctx, accountId, stakes[accountId]); err == nil {
+			collector.pools[accountId] = e
+		}
+	}
+
+	suppressed := 0
+	for accountId, e := range collector.pools {
+		if collector.maxAge > 0 && time.Since(e.fetched) >= collector.maxAge {
+			suppressed++
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.poolDelegatorsDesc, prometheus.GaugeValue, float64(e.delegators), accountId)
+		ch <- prometheus.MustNewConstMetric(collector.poolDelegatedStakeDesc, prometheus.GaugeValue, e.delegated, accountId)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.pendingPoolsDesc, prometheus.GaugeValue, float64(len(stale)-refreshed))
+	ch <- prometheus.MustNewConstMetric(collector.suppressedPoolsDesc, prometheus.GaugeValue, float64(suppressed))
+}
+
+// fetchPool queries the delegators of a pool. On error the previous entry is
+// kept and the pool stays in the refresh queue.
+func (collector *AllPoolsMetrics) fetchPool(ctx context.Context, accountId string, stake string) (*poolEntry, error) {
+	delegators, err := getAllAccounts(ctx, collector.client, accountId, collector.blockId, collector.settings)
+	if err != nil {
+		return nil, err
+	}
+	e := &poolEntry{stake: stake, fetched: time.Now(), delegators: len(delegators)}
+	for _, d := range delegators {
+		e.delegated += collector.settings.amount(d.StakedBalance)
+	}
+	return e, nil
+}
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Unit is a unit of NEAR amounts. The zero value is NEAR.
+type Unit int
+
+const (
+	Near Unit = iota
+	MilliNear
+	YoctoNear
+)
+
+// unitExponents are the powers of ten of yoctoNEAR the units stand for.
+var unitExponents = map[Unit]int64{YoctoNear: 0, MilliNear: 21, Near: 24}
+
+var unitNames = map[Unit]string{YoctoNear: "yoctonear", MilliNear: "millinear", Near: "near"}
+
+func (u Unit) String() string {
+	return unitNames[u]
+}
+
+// ParseUnit parses near, millinear or yoctonear, ignoring case.
+func ParseUnit(s string) (Unit, error) {
+	for u, name := range unitNames {
+		if strings.EqualFold(s, name) {
+			return u, nil
+		}
+	}
+	return Near, fmt.Errorf("unknown unit %q, expected near, millinear or yoctonear", s)
+}
+
+func (u Unit) factor() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(unitExponents[u]), nil)
+}
+
+// unitSymbols are the unit suffixes of amounts besides the unit names.
+var unitSymbols = map[string]Unit{"yNEAR": YoctoNear, "mNEAR": MilliNear, "NEAR": Near}
+
+var amountPattern = regexp.MustCompile(`^([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]{1,3})?$`)
+
+// ParseAmount parses an amount given in unit, as an integer, a decimal or in
+// scientific notation as returned by some view methods, e.g. "1.5e24", into
+// yoctoNEAR. A unit suffix, e.g. "1000 mNEAR" or ".5 NEAR", overrides unit.
+// Fractions of a yoctoNEAR are truncated.
+func ParseAmount(s string, unit Unit) (*big.Int, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 2 {
+		u, ok := unitSymbols[fields[1]]
+		if !ok {
+			var err error
+			if u, err = ParseUnit(fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid %s amount %q: %v", unit, s, err)
+			}
+		}
+		fields, unit = fields[:1], u
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("invalid %s amount %q", unit, s)
+	}
+	r, ok := new(big.Rat).SetString(fields[0])
+	if !ok || !amountPattern.MatchString(fields[0]) {
+		return nil, fmt.Errorf("invalid %s amount %q", unit, s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(unit.factor()))
+	return new(big.Int).Quo(r.Num(), r.Denom()), nil
+}
+
+// ConvertAmount converts a yoctoNEAR amount to unit.
+func ConvertAmount(yocto *big.Int, unit Unit) float64 {
+	v, _ := new(big.Rat).SetFrac(yocto, unit.factor()).Float64()
+	return v
+}
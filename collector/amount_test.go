@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s    string
+		unit Unit
+		want string
+	}{
+		{"1500000000000000000000000", YoctoNear, "1500000000000000000000000"},
+		{"340282366920938463463374607431768211455", YoctoNear, "340282366920938463463374607431768211455"},
+		{"1.5e24", YoctoNear, "1500000000000000000000000"},
+		{"1.5E+24", YoctoNear, "1500000000000000000000000"},
+		{"1.5e24", Near, "1500000000000000000000000000000000000000000000000"},
+		{".5", Near, "500000000000000000000000"},
+		{".5 NEAR", YoctoNear, "500000000000000000000000"},
+		{"1000", MilliNear, "1000000000000000000000000"},
+		{"1000 mNEAR", Near, "1000000000000000000000000"},
+		{"2 millinear", Near, "2000000000000000000000"},
+		{" 7 yNEAR ", Near, "7"},
+		{"1.9", YoctoNear, "1"},
+		{"0.0000000000000000000000019 NEAR", YoctoNear, "1"},
+		{"1e-25", Near, "0"},
+		{"0", Near, "0"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.s, tt.unit)
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %s) error: %v", tt.s, tt.unit, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseAmount(%q, %s) = %s, want %s", tt.s, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestParseAmountInvalid(t *testing.T) {
+	for _, s := range []string{"", "-1", "-1 NEAR", "+1", "abc", "1.2.3", "1/2", "0x10", "1e1000", "NaN", "Inf", "1 BTC", "1 NEAR NEAR", "NEAR"} {
+		if got, err := ParseAmount(s, Near); err == nil {
+			t.Errorf("ParseAmount(%q) = %s, want an error", s, got)
+		}
+	}
+}
+
+func TestConvertAmount(t *testing.T) {
+	large, _ := new(big.Int).SetString("123456789012345678901234567890123", 10)
+	tests := []struct {
+		yocto *big.Int
+		unit  Unit
+		want  float64
+	}{
+		{big.NewInt(1), Near, 1e-24},
+		{big.NewInt(1), MilliNear, 1e-21},
+		{big.NewInt(1), YoctoNear, 1},
+		{large, Near, 123456789.012345678901234567890123},
+		{large, MilliNear, 123456789012.345678901234567890123},
+		{large, YoctoNear, 1.23456789012345678901234567890123e32},
+		// 2^53+1 is not a float64, it is rounded to even.
+		{big.NewInt(9007199254740993), YoctoNear, 9007199254740992},
+		{big.NewInt(0), Near, 0},
+	}
+	for _, tt := range tests {
+		if got := ConvertAmount(tt.yocto, tt.unit); got != tt.want {
+			t.Errorf("ConvertAmount(%s, %s) = %v, want %v", tt.yocto, tt.unit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BlockMetrics exports the timing of the latest blocks, which are walked back
+// from the head by their previous block hash, the load of the latest block
+// and the gas price.
+type BlockMetrics struct {
+	client           nearapi.RPC
+	blockId          string
+	window           int
+	blockTimeDesc    *prometheus.Desc
+	blockTimeAvgDesc *prometheus.Desc
+	chunksDesc       *prometheus.Desc
+	gasPriceDesc     *prometheus.Desc
+	gasUsedDesc      *prometheus.Desc
+	txCountDesc      *prometheus.Desc
+}
+
+// NewBlockMetrics creates the collector for the latest window blocks, at
+// least 2.
+func NewBlockMetrics(client nearapi.RPC, blockId string, window int) *BlockMetrics {
+	if window < 2 {
+		window = 2
+	}
+	return &BlockMetrics{
+		client:  client,
+		blockId: blockId,
+		window:  window,
+		blockTimeDesc: prometheus.NewDesc(
+			"near_block_time_seconds",
+			"Time between the latest block and its previous block",
+			nil,
+			nil,
+		),
+		blockTimeAvgDesc: prometheus.NewDesc(
+			"near_block_time_seconds_avg",
+			"Average time between the latest blocks",
+			nil,
+			nil,
+		),
+		chunksDesc: prometheus.NewDesc(
+			"near_chunks_per_block",
+			"Average number of new chunks included in the latest blocks",
+			nil,
+			nil,
+		),
+		gasPriceDesc: prometheus.NewDesc(
+			"near_gas_price",
+			"Gas price in yoctoNEAR per gas unit",
+			nil,
+			nil,
+		),
+		gasUsedDesc: prometheus.NewDesc(
+			"near_block_gas_used",
+			"Gas used by the new chunks of the latest block",
+			nil,
+			nil,
+		),
+		txCountDesc: prometheus.NewDesc(
+			"near_block_tx_count",
+			"The number of transactions in the new chunks of the latest block",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *BlockMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.blockTimeDesc
+	ch <- collector.blockTimeAvgDesc
+	ch <- collector.chunksDesc
+	ch <- collector.gasPriceDesc
+	ch <- collector.gasUsedDesc
+	ch <- collector.txCountDesc
+}
+
+// latestBlocks returns the latest blocks, newest first.
+func (collector *BlockMetrics) latestBlocks(ctx context.Context) ([]*nearapi.Result, error) {
+	b, err := collector.client.GetContext(ctx, "block", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		return nil, err
+	}
+	blocks := []*nearapi.Result{b}
+	for len(blocks) < collector.window {
+		prevHash := blocks[len(blocks)-1].Block.Header.PrevHash
+		b, err := collector.client.GetContext(ctx, "block", map[string]interface{}{"block_id": prevHash})
+		if err != nil {
+			return nil, err
+		}
+		if b.Block.Header.Hash != prevHash {
+			return nil, fmt.Errorf("block %s not found", prevHash)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func (collector *BlockMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *BlockMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var gasPriceParams interface{} = []interface{}{nil}
+	if collector.blockId != "" {
+		gasPriceParams = []interface{}{BlockId(collector.blockId)}
+	}
+	if r, err := collector.client.GetContext(ctx, "gas_price", gasPriceParams); err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.gasPriceDesc, err)
+	} else {
+		ch <- mustNewYoctoMetric(collector.gasPriceDesc, r.GasPrice.GasPrice)
+	}
+
+	blocks, err := collector.latestBlocks(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.blockTimeDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.blockTimeAvgDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.chunksDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.gasUsedDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.txCountDesc, err)
+		return
+	}
+	newest, oldest := blocks[0].Block.Header, blocks[len(blocks)-1].Block.Header
+	blockTime := float64(newest.Timestamp-blocks[1].Block.Header.Timestamp) / 1e9
+	ch <- prometheus.MustNewConstMetric(collector.blockTimeDesc, prometheus.GaugeValue, blockTime)
+	avg := float64(newest.Timestamp-oldest.Timestamp) / 1e9 / float64(len(blocks)-1)
+	ch <- prometheus.MustNewConstMetric(collector.blockTimeAvgDesc, prometheus.GaugeValue, avg)
+
+	chunks := 0
+	for _, b := range blocks {
+		for _, c := range b.Block.Chunks {
+			if c.HeightIncluded == b.Block.Header.Height {
+				chunks++
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.chunksDesc, prometheus.GaugeValue, float64(chunks)/float64(len(blocks)))
+
+	collector.collectLoad(ctx, ch, blocks[0])
+}
+
+// collectLoad exports the gas used and the transactions of the new chunks of
+// the latest block. Transactions are only listed by the chunk RPC.
+func (collector *BlockMetrics) collectLoad(ctx context.Context, ch chan<- prometheus.Metric, b *nearapi.Result) {
+	var gasUsed uint64
+	txs := 0
+	for _, c := range b.Block.Chunks {
+		if c.HeightIncluded != b.Block.Header.Height {
+			continue
+		}
+		gasUsed += c.GasUsed
+		r, err := collector.client.GetContext(ctx, "chunk", map[string]interface{}{"chunk_id": c.ChunkHash})
+		if err != nil {
+			ch <- prometheus.MustNewConstMetric(collector.gasUsedDesc, prometheus.GaugeValue, float64(gasUsed))
+			ch <- prometheus.NewInvalidMetric(collector.txCountDesc, err)
+			return
+		}
+		txs += len(r.Chunk.Transactions)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.gasUsedDesc, prometheus.GaugeValue, float64(gasUsed))
+	ch <- prometheus.MustNewConstMetric(collector.txCountDesc, prometheus.GaugeValue, float64(txs))
+}
@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CacheMetrics exports the age of disk cached responses served instead of
+// live RPC responses.
+type CacheMetrics struct {
+	clients         []*nearapi.Client
+	fallbackAgeDesc *prometheus.Desc
+}
+
+func NewCacheMetrics(clients ...*nearapi.Client) *CacheMetrics {
+	return &CacheMetrics{
+		clients: clients,
+		fallbackAgeDesc: prometheus.NewDesc(
+			"near_exporter_cached_response_age_seconds",
+			"Age of the disk cached response served because the RPC call failed",
+			[]string{"endpoint", "method"},
+			nil,
+		),
+	}
+}
+
+func (collector *CacheMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.fallbackAgeDesc
+}
+
+func (collector *CacheMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range collector.clients {
+		for method, stored := range c.Fallbacks() {
+			ch <- prometheus.MustNewConstMetric(collector.fallbackAgeDesc, prometheus.GaugeValue, time.Since(stored).Seconds(), c.Endpoint, method)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type delegationState struct {
+	epoch       int64
+	staked      float64
+	lastReward  float64
+	rewardTotal float64
+}
+
+// DelegatorMetrics exports the balances of a delegator account in a list of
+// staking pools. Without configured pools the pools are discovered among the
+// current validators once per epoch, and again on every collection until a
+// discovery completes. Rewards are estimated from the growth of
+// the staked balance between epochs, so deposits during an epoch are counted
+// as rewards as well.
+type DelegatorMetrics struct {
+	client    nearapi.RPC
+	settings  Settings
+	accountId string
+	pools     []string
+	blockId   string
+
+	mu              sync.Mutex
+	discoveredEpoch int64
+	discovered      []string
+	state           map[string]*delegationState
+
+	stakedBalanceDesc   *prometheus.Desc
+	unstakedBalanceDesc *prometheus.Desc
+	canWithdrawDesc     *prometheus.Desc
+	epochRewardDesc     *prometheus.Desc
+	rewardsTotalDesc    *prometheus.Desc
+}
+
+func NewDelegatorMetrics(client nearapi.RPC, accountId string, pools []string, blockId string, settings Settings) *DelegatorMetrics {
+	return &DelegatorMetrics{
+		client:          client,
+		settings:        settings,
+		accountId:       accountId,
+		pools:           pools,
+		blockId:         blockId,
+		discoveredEpoch: -1,
+		state:           make(map[string]*delegationState),
+		stakedBalanceDesc: prometheus.NewDesc(
+			"near_delegator_staked_balance",
+			"Staked balance of the delegator account in a staking pool",
+			[]string{"pool_id"},
+			nil,
+		),
+		unstakedBalanceDesc: prometheus.NewDesc(
+			"near_delegator_unstaked_balance",
+			"Unstaked balance of the delegator account in a staking pool",
+			[]string{"pool_id"},
+			nil,
+		),
+		canWithdrawDesc: prometheus.NewDesc(
+			"near_delegator_can_withdraw",
+			"Whether the unstaked balance of the delegator account can be withdrawn",
+			[]string{"pool_id"},
+			nil,
+		),
+		epochRewardDesc: prometheus.NewDesc(
+			"near_delegator_epoch_reward",
+			"Growth of the staked balance in the last epoch",
+			[]string{"pool_id", "epoch"},
+			nil,
+		),
+		rewardsTotalDesc: prometheus.NewDesc(
+			"near_delegator_rewards_total",
+			"Rewards accrued since the exporter started",
+			[]string{"pool_id"},
+			nil,
+		),
+	}
+}
+
+func (collector *DelegatorMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.stakedBalanceDesc
+	ch <- collector.unstakedBalanceDesc
+	ch <- collector.canWithdrawDesc
+	ch <- collector.epochRewardDesc
+	ch <- collector.rewardsTotalDesc
+}
+
+func (collector *DelegatorMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *DelegatorMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var validatorsParams interface{} = "latest"
+	if collector.blockId != "" {
+		validatorsParams = []interface{}{BlockId(collector.blockId)}
+	}
+	r, err := collector.client.GetContext(ctx, "validators", validatorsParams)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.stakedBalanceDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.unstakedBalanceDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.canWithdrawDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.epochRewardDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.rewardsTotalDesc, err)
+		return
+	}
+	epoch := r.Validators.EpochHeight
+
+	pools := collector.pools
+	if len(pools) == 0 {
+		collector.mu.Lock()
+		discovered := collector.discoveredEpoch == epoch
+		pools = collector.discovered
+		collector.mu.Unlock()
+		if !discovered {
+			found, err := collector.discover(ctx, r.Validators.CurrentValidators)
+			if err != nil {
+				// Keep the pools found before until a discovery completes.
+				ch <- prometheus.NewInvalidMetric(collector.stakedBalanceDesc, err)
+				found = mergePools(pools, found)
+			}
+			collector.mu.Lock()
+			collector.discovered = found
+			if err == nil {
+				collector.discoveredEpoch = epoch
+			}
+			collector.mu.Unlock()
+			pools = found
+		}
+	}
+
+	for _, pool := range pools {
+		account, err := getAccount(ctx, collector.client, pool, collector.accountId, collector.blockId)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(collector.stakedBalanceDesc, err)
+			continue
+		}
+		staked := collector.settings.amount(account.StakedBalance)
+		ch <- prometheus.MustNewConstMetric(collector.stakedBalanceDesc, prometheus.GaugeValue, staked, pool)
+		ch <- prometheus.MustNewConstMetric(collector.unstakedBalanceDesc, prometheus.GaugeValue, collector.settings.amount(account.UnstakedBalance), pool)
+		var canWithdraw float64
+		if account.CanWithdraw {
+			canWithdraw = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.canWithdrawDesc, prometheus.GaugeValue, canWithdraw, pool)
+
+		collector.mu.Lock()
+		s, ok := collector.state[pool]
+		if !ok {
+			s = &delegationState{epoch: epoch, staked: staked}
+			collector.state[pool] = s
+		}
+		if epoch > s.epoch {
+			s.lastReward = staked - s.staked
+			if s.lastReward > 0 {
+				s.rewardTotal += s.lastReward
+			}
+			s.epoch = epoch
+			s.staked = staked
+		}
+		lastReward, rewardTotal := s.lastReward, s.rewardTotal
+		collector.mu.Unlock()
+		ch <- prometheus.MustNewConstMetric(collector.epochRewardDesc, prometheus.GaugeValue, lastReward, pool, fmt.Sprintf("%d", epoch))
+		ch <- prometheus.MustNewConstMetric(collector.rewardsTotalDesc, prometheus.CounterValue, rewardTotal, pool)
+	}
+}
+
+// discover finds the pools among the current validators in which the
+// delegator account has a balance. Validators whose contract answers with an
+// RPC error, e.g. because it is not a staking pool, are skipped. Other errors,
+// e.g. timeouts, fail the discovery, returning the pools found anyway.
+func (collector *DelegatorMetrics) discover(ctx context.Context, validators []nearapi.CurrentValidator) ([]string, error) {
+	var pools []string
+	var failed error
+	for _, v := range validators {
+		account, err := getAccount(ctx, collector.client, v.AccountId, collector.accountId, collector.blockId)
+		var rpcErr *nearapi.Error
+		if errors.As(err, &rpcErr) {
+			continue
+		}
+		if err != nil {
+			failed = err
+			continue
+		}
+		if collector.settings.amount(account.StakedBalance) > 0 || collector.settings.amount(account.UnstakedBalance) > 0 {
+			pools = append(pools, v.AccountId)
+		}
+	}
+	return pools, failed
+}
+
+// mergePools returns the pools of a and b, each once.
+func mergePools(a []string, b []string) []string {
+	res := append([]string(nil), a...)
+	for _, pool := range b {
+		found := false
+		for _, p := range a {
+			found = found || p == pool
+		}
+		if !found {
+			res = append(res, pool)
+		}
+	}
+	return res
+}
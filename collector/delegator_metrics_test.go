@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const delegatorStakes = `
+# HELP near_delegator_staked_balance Staked balance of the delegator account in a staking pool
+# TYPE near_delegator_staked_balance gauge
+`
+
+func TestDelegatorMetricsDiscovery(t *testing.T) {
+	n := rpctest.NewNode()
+	srv := rpctest.NewServer(n)
+	defer srv.Close()
+
+	c := NewDelegatorMetrics(nearapi.NewClient(srv.URL), "alice.test", nil, "", Settings{})
+	want := delegatorStakes + `near_delegator_staked_balance{pool_id="validator.test"} 1000` + "\n"
+	for i := 0; i < 2; i++ {
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want), "near_delegator_staked_balance"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Both validators are queried by the discovery, the pool by every
+	// collection.
+	if got := n.Calls("query"); got != 4 {
+		t.Errorf("got %d queries, want 4", got)
+	}
+}
+
+func TestDelegatorMetricsFailedDiscovery(t *testing.T) {
+	n := rpctest.NewNode()
+	n.HandleView(rpctest.OtherValidatorId, "get_account", func(json.RawMessage) (interface{}, error) {
+		time.Sleep(300 * time.Millisecond)
+		return rpctest.Delegator{AccountId: "alice.test", UnstakedBalance: "0", StakedBalance: "2000000000000000000000000000"}, nil
+	})
+	srv := rpctest.NewServer(n)
+	defer srv.Close()
+
+	client := nearapi.NewClient(srv.URL)
+	client.SetTimeout(100 * time.Millisecond)
+	c := NewDelegatorMetrics(client, "alice.test", nil, "", Settings{})
+	err := testutil.CollectAndCompare(c, strings.NewReader(""), "near_delegator_staked_balance")
+	if err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Fatalf("got error %v, want the timeout of the discovery", err)
+	}
+
+	// The discovery is repeated on the next collection.
+	client.SetTimeout(time.Second)
+	want := delegatorStakes + `near_delegator_staked_balance{pool_id="validator.test"} 1000
+near_delegator_staked_balance{pool_id="other.test"} 2000
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "near_delegator_staked_balance"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Number of recent blocks the block time is averaged over.
+const blockTimeWindow = 500
+
+type EpochMetrics struct {
+	client          nearapi.RPC
+	blockId         string
+	epochLengthDesc *prometheus.Desc
+	progressDesc    *prometheus.Desc
+	remainingDesc   *prometheus.Desc
+}
+
+func NewEpochMetrics(client nearapi.RPC, blockId string) *EpochMetrics {
+	return &EpochMetrics{
+		client:  client,
+		blockId: blockId,
+		epochLengthDesc: prometheus.NewDesc(
+			"near_epoch_length",
+			"The number of blocks in an epoch from protocol config",
+			nil,
+			nil,
+		),
+		progressDesc: prometheus.NewDesc(
+			"near_epoch_progress_ratio",
+			"Part of the current epoch that has passed",
+			nil,
+			nil,
+		),
+		remainingDesc: prometheus.NewDesc(
+			"near_epoch_remaining_seconds",
+			"Estimated time until the next epoch, based on the recent block time",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *EpochMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.epochLengthDesc
+	ch <- collector.progressDesc
+	ch <- collector.remainingDesc
+}
+
+func (collector *EpochMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *EpochMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var validatorsParams interface{} = "latest"
+	if collector.blockId != "" {
+		validatorsParams = []interface{}{BlockId(collector.blockId)}
+	}
+	pc, err := collector.client.GetContext(ctx, "EXPERIMENTAL_protocol_config", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.epochLengthDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.progressDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.remainingDesc, err)
+		return
+	}
+	epochLength := pc.ProtocolConfig.EpochLength
+	ch <- prometheus.MustNewConstMetric(collector.epochLengthDesc, prometheus.GaugeValue, float64(epochLength))
+
+	v, err := collector.client.GetContext(ctx, "validators", validatorsParams)
+	if err == nil && epochLength == 0 {
+		err = fmt.Errorf("epoch length missing in protocol config")
+	}
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.progressDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.remainingDesc, err)
+		return
+	}
+	b, err := collector.client.GetContext(ctx, "block", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.progressDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.remainingDesc, err)
+		return
+	}
+	header := b.Block.Header
+	start := v.Validators.EpochStartHeight
+	passed := int64(header.Height) - start
+	ch <- prometheus.MustNewConstMetric(collector.progressDesc, prometheus.GaugeValue, float64(passed)/float64(epochLength))
+
+	blockTime, err := collector.blockTime(ctx, int64(header.Height), header.Timestamp, start)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.remainingDesc, err)
+		return
+	}
+	remaining := epochLength - passed
+	if remaining < 0 {
+		remaining = 0
+	}
+	ch <- prometheus.MustNewConstMetric(collector.remainingDesc, prometheus.GaugeValue, float64(remaining)*blockTime)
+}
+
+// blockTime averages the time per block height over the last
+// blockTimeWindow heights of the epoch. Heights may be skipped, so the epoch
+// start block, which always exists, is used when the block at the start of
+// the window doesn't.
+func (collector *EpochMetrics) blockTime(ctx context.Context, height int64, timestamp uint64, epochStart int64) (float64, error) {
+	from := height - blockTimeWindow
+	if from < epochStart {
+		from = epochStart
+	}
+	b, err := collector.client.GetContext(ctx, "block", map[string]interface{}{"block_id": from})
+	if (err != nil || b.Block.Header.Timestamp == 0) && from != epochStart {
+		from = epochStart
+		b, err = collector.client.GetContext(ctx, "block", map[string]interface{}{"block_id": from})
+	}
+	if err != nil {
+		return 0, err
+	}
+	if b.Block.Header.Timestamp == 0 || height <= from {
+		return 0, fmt.Errorf("not enough blocks in epoch to estimate block time")
+	}
+	return float64(timestamp-b.Block.Header.Timestamp) / 1e9 / float64(height-from), nil
+}
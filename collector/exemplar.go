@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// exemplarMetric attaches an exemplar to a const counter. Exemplars are only
+// exposed when the scrape negotiates the OpenMetrics format.
+type exemplarMetric struct {
+	prometheus.Metric
+	exemplar *dto.Exemplar
+}
+
+func (m *exemplarMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	if out.Counter != nil {
+		out.Counter.Exemplar = m.exemplar
+	}
+	return nil
+}
+
+func mustNewCounterWithExemplar(desc *prometheus.Desc, value float64, exemplar prometheus.Labels, labelValues ...string) prometheus.Metric {
+	names := make([]string, 0, len(exemplar))
+	for name := range exemplar {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e := &dto.Exemplar{Value: &value}
+	for _, name := range names {
+		name, v := name, exemplar[name]
+		e.Label = append(e.Label, &dto.LabelPair{Name: &name, Value: &v})
+	}
+	return &exemplarMetric{
+		Metric:   prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labelValues...),
+		exemplar: e,
+	}
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type NetworkMetrics struct {
+	client             nearapi.RPC
+	peerCountDesc      *prometheus.Desc
+	maxPeerCountDesc   *prometheus.Desc
+	sentBytesDesc      *prometheus.Desc
+	receivedBytesDesc  *prometheus.Desc
+	knownProducersDesc *prometheus.Desc
+}
+
+func NewNetworkMetrics(client nearapi.RPC) *NetworkMetrics {
+	return &NetworkMetrics{
+		client: client,
+		peerCountDesc: prometheus.NewDesc(
+			"near_peer_count",
+			"The number of active peers of the node",
+			nil,
+			nil,
+		),
+		maxPeerCountDesc: prometheus.NewDesc(
+			"near_max_peer_count",
+			"The maximum number of peers of the node",
+			nil,
+			nil,
+		),
+		sentBytesDesc: prometheus.NewDesc(
+			"near_sent_bytes_per_sec",
+			"Bytes per second sent to peers",
+			nil,
+			nil,
+		),
+		receivedBytesDesc: prometheus.NewDesc(
+			"near_received_bytes_per_sec",
+			"Bytes per second received from peers",
+			nil,
+			nil,
+		),
+		knownProducersDesc: prometheus.NewDesc(
+			"near_known_producers_count",
+			"The number of block producers known to the node",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *NetworkMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.peerCountDesc
+	ch <- collector.maxPeerCountDesc
+	ch <- collector.sentBytesDesc
+	ch <- collector.receivedBytesDesc
+	ch <- collector.knownProducersDesc
+}
+
+func (collector *NetworkMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *NetworkMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	r, err := collector.client.GetContext(ctx, "network_info", nil)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.peerCountDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.maxPeerCountDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.sentBytesDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.receivedBytesDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.knownProducersDesc, err)
+		return
+	}
+	ni := r.NetworkInfo
+	ch <- prometheus.MustNewConstMetric(collector.peerCountDesc, prometheus.GaugeValue, float64(ni.NumActivePeers))
+	ch <- prometheus.MustNewConstMetric(collector.maxPeerCountDesc, prometheus.GaugeValue, float64(ni.PeerMaxCount))
+	ch <- prometheus.MustNewConstMetric(collector.sentBytesDesc, prometheus.GaugeValue, float64(ni.SentBytesPerSec))
+	ch <- prometheus.MustNewConstMetric(collector.receivedBytesDesc, prometheus.GaugeValue, float64(ni.ReceivedBytesPerSec))
+	ch <- prometheus.MustNewConstMetric(collector.knownProducersDesc, prometheus.GaugeValue, float64(len(ni.KnownProducers)))
+}
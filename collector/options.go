@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options configures the collectors New creates, as the exporter's flags of
+// the same names do.
+type Options struct {
+	// Client serves the chain data.
+	Client nearapi.RPC
+	// NodeClient serves the status of the node itself, Client if nil.
+	NodeClient nearapi.RPC
+	// Accounts are the validator accounts monitored. With several accounts
+	// their metrics are labeled with account_id, and the validator key of
+	// the node is not checked, as it runs only one of them.
+	Accounts []string
+	// BlockId is the block height or hash to query, the latest block if
+	// empty.
+	BlockId string
+	// Timeout aborts the collections taking longer, none if 0.
+	Timeout time.Duration
+	// OnTimeout, if not nil, is called with the name of a collector whose
+	// collection was aborted.
+	OnTimeout func(name string)
+	// RecentBlocks is the number of blocks the block times are computed
+	// over, 10 if 0.
+	RecentBlocks int
+	// Exemplars exports the block and epoch height counters with
+	// OpenMetrics exemplars.
+	Exemplars bool
+	// AllProposals exports the proposals of all accounts, with one account
+	// only.
+	AllProposals bool
+	// VersionBuildMetric also exports the deprecated near_version_build
+	// metric.
+	VersionBuildMetric bool
+	// VersionBuildHash exports the FNV hash of the build as its value.
+	VersionBuildHash bool
+	// Lite skips the account, protocol and epoch collectors.
+	Lite bool
+	// ReferenceClient, if not nil, is the RPC the head of the node is
+	// compared with.
+	ReferenceClient nearapi.RPC
+	// Delegator, if not empty, is the delegator account whose stakes in
+	// DelegatorPools, all current validators if empty, are exported.
+	Delegator      string
+	DelegatorPools []string
+	// BalanceAccounts are accounts whose balances are exported.
+	BalanceAccounts []string
+	// AllPools exports the delegator aggregates of all current validators,
+	// re-querying at most AllPoolsBatch pools, 10 if 0, per collection.
+	// Cached values older than MaxCacheAge are not exported, unless it is 0.
+	AllPools      bool
+	AllPoolsBatch int
+	MaxCacheAge   time.Duration
+	// Settings are the amount unit and the staking pool options.
+	Settings Settings
+	// Production accumulates the produced blocks and chunks, in memory if
+	// nil.
+	Production *ProductionState
+}
+
+// Named is a collector created by New with the name the exporter gives it in
+// near_exporter_collector_* metrics and -collectors, and the labels to add to
+// its metrics.
+type Named struct {
+	Name      string
+	Collector prometheus.Collector
+	Labels    prometheus.Labels
+}
+
+// New creates the node, network and block collectors and, unless opts.Lite,
+// the validator, staking pool, validator key and reward collectors of every
+// account and the protocol and epoch collectors. The reference, delegator,
+// account balance and all-pools collectors are added when configured. The
+// cache collector of the exporter needs a *nearapi.Client and is created
+// with NewCacheMetrics.
+func New(opts Options) []Named {
+	client, nodeClient := opts.Client, opts.NodeClient
+	if nodeClient == nil {
+		nodeClient = client
+	}
+	recentBlocks := opts.RecentBlocks
+	if recentBlocks == 0 {
+		recentBlocks = 10
+	}
+	var res []Named
+	add := func(name string, c prometheus.Collector, labels prometheus.Labels) {
+		var onTimeout func()
+		if opts.OnTimeout != nil {
+			onTimeout = func() { opts.OnTimeout(name) }
+		}
+		res = append(res, Named{name, WithTimeout(c, opts.Timeout, onTimeout), labels})
+	}
+
+	add("node", NewNodeRpcMetrics(nodeClient, opts.VersionBuildMetric, opts.VersionBuildHash, opts.Exemplars), nil)
+	add("network", NewNetworkMetrics(nodeClient), nil)
+	add("block", NewBlockMetrics(nodeClient, opts.BlockId, recentBlocks), nil)
+	if !opts.Lite {
+		proposals := opts.AllProposals && len(opts.Accounts) == 1
+		for _, id := range opts.Accounts {
+			suffix, labels := "", prometheus.Labels(nil)
+			if len(opts.Accounts) > 1 {
+				suffix, labels = "/"+id, prometheus.Labels{"account_id": id}
+			}
+			add("validator"+suffix, NewValidatorMetrics(client, id, opts.BlockId, opts.Exemplars, proposals, opts.Production, opts.Settings), labels)
+			add("staking_pool"+suffix, NewStakingPoolMetrics(client, id, opts.BlockId, opts.Settings), labels)
+			if len(opts.Accounts) == 1 {
+				add("validator_key", NewValidatorKeyMetrics(nodeClient, client, id, opts.BlockId), nil)
+			}
+			add("reward"+suffix, NewRewardMetrics(client, id, opts.BlockId, opts.Settings), labels)
+		}
+		add("protocol", NewProtocolMetrics(client, opts.BlockId), nil)
+		add("epoch", NewEpochMetrics(client, opts.BlockId), nil)
+	}
+	if opts.ReferenceClient != nil {
+		add("reference", NewReferenceMetrics(nodeClient, opts.ReferenceClient), nil)
+	}
+	if opts.Delegator != "" {
+		add("delegator", NewDelegatorMetrics(client, opts.Delegator, opts.DelegatorPools, opts.BlockId, opts.Settings), nil)
+	}
+	if len(opts.BalanceAccounts) > 0 {
+		add("account_balance", NewAccountBalanceMetrics(client, opts.BalanceAccounts, opts.BlockId, opts.Settings), nil)
+	}
+	if opts.AllPools {
+		batch := opts.AllPoolsBatch
+		if batch == 0 {
+			batch = 10
+		}
+		add("all_pools", NewAllPoolsMetrics(client, opts.BlockId, batch, opts.MaxCacheAge, opts.Settings), nil)
+	}
+	return res
+}
+
+// Register registers the collectors New creates with r.
+func Register(r prometheus.Registerer, opts Options) error {
+	for _, c := range New(opts) {
+		if err := prometheus.WrapRegistererWith(c.Labels, r).Register(c.Collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
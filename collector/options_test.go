@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewNames(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "one account",
+			opts: Options{Accounts: []string{"a.test"}},
+			want: []string{"node", "network", "block", "validator", "staking_pool", "validator_key", "reward", "protocol", "epoch"},
+		},
+		{
+			name: "several accounts",
+			opts: Options{Accounts: []string{"a.test", "b.test"}},
+			want: []string{"node", "network", "block", "validator/a.test", "staking_pool/a.test", "reward/a.test",
+				"validator/b.test", "staking_pool/b.test", "reward/b.test", "protocol", "epoch"},
+		},
+		{
+			name: "lite",
+			opts: Options{Accounts: []string{"a.test"}, Lite: true, Delegator: "d.test", BalanceAccounts: []string{"a.test"}, AllPools: true},
+			want: []string{"node", "network", "block", "delegator", "account_balance", "all_pools"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range New(tt.opts) {
+				got = append(got, c.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
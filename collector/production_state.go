@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+)
+
+type production struct {
+	BlocksProduced int64 `json:"blocks_produced"`
+	BlocksExpected int64 `json:"blocks_expected"`
+	ChunksProduced int64 `json:"chunks_produced"`
+	ChunksExpected int64 `json:"chunks_expected"`
+}
+
+// productionCounters are the counts of an account in Epoch at the last
+// scrape and its cumulative counts over all epochs.
+type productionCounters struct {
+	Epoch int64      `json:"epoch"`
+	Last  production `json:"last"`
+	Total production `json:"total"`
+}
+
+// ProductionState accumulates the produced and expected blocks and chunks of
+// validators across epochs, which the RPC only reports for the current one.
+// With a path it is persisted as JSON, so that the totals survive restarts.
+// The counts of an epoch after its last scrape are missed.
+type ProductionState struct {
+	mu       sync.Mutex
+	path     string
+	accounts map[string]*productionCounters
+}
+
+// NewProductionState creates the state, loading it from path if it exists.
+// An empty path keeps the state in memory only.
+func NewProductionState(path string) (*ProductionState, error) {
+	s := &ProductionState{path: path, accounts: make(map[string]*productionCounters)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.accounts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// update adds the counts of v since the last scrape to the totals of
+// accountId and returns them. Counts lower than at the last scrape are
+// taken as a new epoch.
+func (s *ProductionState) update(accountId string, epoch int64, v nearapi.CurrentValidator) production {
+	p := production{v.NumProducedBlocks, v.NumExpectedBlocks, v.NumProducedChunks, v.NumExpectedChunks}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.accounts[accountId]
+	if !ok {
+		c = &productionCounters{Epoch: epoch}
+		s.accounts[accountId] = c
+	}
+	if c.Epoch == epoch && c.Last == p {
+		return c.Total
+	}
+	last := c.Last
+	if c.Epoch != epoch {
+		last = production{}
+	}
+	c.Total.BlocksProduced += countDelta(last.BlocksProduced, p.BlocksProduced)
+	c.Total.BlocksExpected += countDelta(last.BlocksExpected, p.BlocksExpected)
+	c.Total.ChunksProduced += countDelta(last.ChunksProduced, p.ChunksProduced)
+	c.Total.ChunksExpected += countDelta(last.ChunksExpected, p.ChunksExpected)
+	c.Epoch, c.Last = epoch, p
+	if err := s.save(); err != nil {
+		logging.Warn("saving production state failed", "path", s.path, "err", err)
+	}
+	return c.Total
+}
+
+func countDelta(last int64, current int64) int64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+func (s *ProductionState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+)
+
+// scrape is the production of an account in epoch reported by a scrape.
+type scrape struct {
+	epoch int64
+	p     production
+}
+
+func validatorWith(p production) nearapi.CurrentValidator {
+	return nearapi.CurrentValidator{
+		NumProducedBlocks: p.BlocksProduced,
+		NumExpectedBlocks: p.BlocksExpected,
+		NumProducedChunks: p.ChunksProduced,
+		NumExpectedChunks: p.ChunksExpected,
+	}
+}
+
+func TestProductionStateUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		scrapes []scrape
+		want    production
+	}{
+		{
+			name:    "first scrape",
+			scrapes: []scrape{{100, production{95, 100, 380, 400}}},
+			want:    production{95, 100, 380, 400},
+		},
+		{
+			name:    "same epoch",
+			scrapes: []scrape{{100, production{95, 100, 380, 400}}, {100, production{97, 102, 388, 408}}},
+			want:    production{97, 102, 388, 408},
+		},
+		{
+			name:    "same counts",
+			scrapes: []scrape{{100, production{95, 100, 380, 400}}, {100, production{95, 100, 380, 400}}, {100, production{95, 100, 380, 400}}},
+			want:    production{95, 100, 380, 400},
+		},
+		{
+			name:    "epoch change",
+			scrapes: []scrape{{100, production{95, 100, 380, 400}}, {101, production{5, 6, 20, 24}}, {101, production{10, 12, 40, 48}}},
+			want:    production{105, 112, 420, 448},
+		},
+		{
+			name:    "epoch change with higher counts",
+			scrapes: []scrape{{100, production{5, 6, 20, 24}}, {101, production{10, 12, 40, 48}}},
+			want:    production{15, 18, 60, 72},
+		},
+		{
+			name:    "lower counts in the same epoch",
+			scrapes: []scrape{{100, production{95, 100, 380, 400}}, {100, production{3, 4, 12, 16}}},
+			want:    production{98, 104, 392, 416},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewProductionState("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got production
+			for _, sc := range tt.scrapes {
+				got = s.update(rpctest.ValidatorId, sc.epoch, validatorWith(sc.p))
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductionStateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "production.json")
+
+	s, err := NewProductionState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.update(rpctest.ValidatorId, 100, validatorWith(production{95, 100, 380, 400}))
+	s.update(rpctest.OtherValidatorId, 100, validatorWith(production{1, 2, 3, 4}))
+
+	// The first scrape after a restart reports the counts already added.
+	s, err = NewProductionState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.update(rpctest.ValidatorId, 100, validatorWith(production{95, 100, 380, 400})), (production{95, 100, 380, 400}); got != want {
+		t.Errorf("after reload got %+v, want %+v", got, want)
+	}
+	if got, want := s.update(rpctest.ValidatorId, 100, validatorWith(production{97, 102, 388, 408})), (production{97, 102, 388, 408}); got != want {
+		t.Errorf("same epoch after reload got %+v, want %+v", got, want)
+	}
+	if got, want := s.update(rpctest.ValidatorId, 101, validatorWith(production{1, 1, 4, 4})), (production{98, 103, 392, 412}); got != want {
+		t.Errorf("next epoch after reload got %+v, want %+v", got, want)
+	}
+
+	s, err = NewProductionState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.update(rpctest.OtherValidatorId, 100, validatorWith(production{1, 2, 3, 4})), (production{1, 2, 3, 4}); got != want {
+		t.Errorf("other account after reload got %+v, want %+v", got, want)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestProductionStateInvalidFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("{not json")
+	f.Close()
+	if _, err := NewProductionState(f.Name()); err == nil {
+		t.Error("want an error for an invalid state file")
+	}
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"context"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ProtocolMetrics struct {
+	client                    nearapi.RPC
+	blockId                   string
+	numBlockProducerSeatsDesc *prometheus.Desc
+	numChunkProducerSeatsDesc *prometheus.Desc
+	votedProtocolDesc         *prometheus.Desc
+	upgradePendingDesc        *prometheus.Desc
+	blockKickoutDesc          *prometheus.Desc
+	chunkKickoutDesc          *prometheus.Desc
+}
+
+func NewProtocolMetrics(client nearapi.RPC, blockId string) *ProtocolMetrics {
+	return &ProtocolMetrics{
+		client:  client,
+		blockId: blockId,
+		numBlockProducerSeatsDesc: prometheus.NewDesc(
+			"near_num_block_producer_seats",
+			"The number of block producer seats from protocol config",
+			nil,
+			nil,
+		),
+		numChunkProducerSeatsDesc: prometheus.NewDesc(
+			"near_num_chunk_producer_seats",
+			"The number of chunk producer seats from protocol config",
+			nil,
+			nil,
+		),
+		blockKickoutDesc: prometheus.NewDesc(
+			"near_protocol_block_producer_kickout_threshold",
+			"Block productivity ratio below which block producers are kicked out",
+			nil,
+			nil,
+		),
+		chunkKickoutDesc: prometheus.NewDesc(
+			"near_protocol_chunk_producer_kickout_threshold",
+			"Chunk productivity ratio below which chunk producers are kicked out",
+			nil,
+			nil,
+		),
+		votedProtocolDesc: prometheus.NewDesc(
+			"near_latest_block_voted_protocol_version",
+			"The protocol version voted for by the producer of the latest block. It is a single vote, the next epoch switches to a version only when block producers holding enough stake voted for it",
+			nil,
+			nil,
+		),
+		upgradePendingDesc: prometheus.NewDesc(
+			"near_protocol_upgrade_pending",
+			"Whether the producer of the latest block voted for a protocol version greater than the current one, a sign that an upgrade is coming rather than its activation in the next epoch",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *ProtocolMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.numBlockProducerSeatsDesc
+	ch <- collector.numChunkProducerSeatsDesc
+	ch <- collector.blockKickoutDesc
+	ch <- collector.chunkKickoutDesc
+	ch <- collector.votedProtocolDesc
+	ch <- collector.upgradePendingDesc
+}
+
+func (collector *ProtocolMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *ProtocolMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	r, err := collector.client.GetContext(ctx, "EXPERIMENTAL_protocol_config", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.numBlockProducerSeatsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.numChunkProducerSeatsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.blockKickoutDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.chunkKickoutDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.votedProtocolDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.upgradePendingDesc, err)
+		return
+	}
+	pc := r.ProtocolConfig
+	ch <- prometheus.MustNewConstMetric(collector.numBlockProducerSeatsDesc, prometheus.GaugeValue, float64(pc.NumBlockProducerSeats))
+
+	// Protocol versions before stateless validation have no dedicated chunk
+	// producer seats: every block producer also produces chunks.
+	chunkSeats := pc.NumChunkProducerSeats
+	if chunkSeats == 0 {
+		chunkSeats = pc.NumBlockProducerSeats + pc.NumChunkOnlyProducerSeats
+	}
+	ch <- prometheus.MustNewConstMetric(collector.numChunkProducerSeatsDesc, prometheus.GaugeValue, float64(chunkSeats))
+	ch <- prometheus.MustNewConstMetric(collector.blockKickoutDesc, prometheus.GaugeValue, float64(pc.BlockProducerKickoutThreshold)/100)
+	ch <- prometheus.MustNewConstMetric(collector.chunkKickoutDesc, prometheus.GaugeValue, float64(pc.ChunkProducerKickoutThreshold)/100)
+
+	// Every block header carries the protocol version its producer votes
+	// for. The version of the next epoch is decided by the votes weighted
+	// by stake, which the RPC does not expose, so only the vote of the
+	// latest block is exported.
+	b, err := collector.client.GetContext(ctx, "block", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.votedProtocolDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.upgradePendingDesc, err)
+		return
+	}
+	votedVersion := b.Block.Header.LatestProtocolVersion
+	ch <- prometheus.MustNewConstMetric(collector.votedProtocolDesc, prometheus.GaugeValue, float64(votedVersion))
+
+	var upgradePending float64
+	if votedVersion > pc.ProtocolVersion {
+		upgradePending = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collector.upgradePendingDesc, prometheus.GaugeValue, upgradePending)
+}
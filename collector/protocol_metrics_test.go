@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const protocolMetrics = `
+# HELP near_num_block_producer_seats The number of block producer seats from protocol config
+# TYPE near_num_block_producer_seats gauge
+near_num_block_producer_seats 100
+# HELP near_num_chunk_producer_seats The number of chunk producer seats from protocol config
+# TYPE near_num_chunk_producer_seats gauge
+near_num_chunk_producer_seats 300
+# HELP near_protocol_block_producer_kickout_threshold Block productivity ratio below which block producers are kicked out
+# TYPE near_protocol_block_producer_kickout_threshold gauge
+near_protocol_block_producer_kickout_threshold 0.9
+# HELP near_protocol_chunk_producer_kickout_threshold Chunk productivity ratio below which chunk producers are kicked out
+# TYPE near_protocol_chunk_producer_kickout_threshold gauge
+near_protocol_chunk_producer_kickout_threshold 0.9
+# HELP near_latest_block_voted_protocol_version The protocol version voted for by the producer of the latest block. It is a single vote, the next epoch switches to a version only when block producers holding enough stake voted for it
+# TYPE near_latest_block_voted_protocol_version gauge
+# HELP near_protocol_upgrade_pending Whether the producer of the latest block voted for a protocol version greater than the current one, a sign that an upgrade is coming rather than its activation in the next epoch
+# TYPE near_protocol_upgrade_pending gauge
+`
+
+func TestProtocolMetricsCollect(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(n *rpctest.Node)
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no upgrade",
+			want: protocolMetrics + "near_latest_block_voted_protocol_version 60\nnear_protocol_upgrade_pending 0\n",
+		},
+		{
+			name: "newer version voted",
+			setup: func(n *rpctest.Node) {
+				n.SetResult("block", map[string]interface{}{"header": map[string]interface{}{"latest_protocol_version": 61}})
+			},
+			want: protocolMetrics + "near_latest_block_voted_protocol_version 61\nnear_protocol_upgrade_pending 1\n",
+		},
+		{
+			name:    "protocol config error",
+			setup:   func(n *rpctest.Node) { n.Fail("EXPERIMENTAL_protocol_config", http.StatusBadGateway) },
+			wantErr: "EXPERIMENTAL_protocol_config: 502 Bad Gateway",
+		},
+		{
+			name:    "block error",
+			setup:   func(n *rpctest.Node) { n.Fail("block", http.StatusBadGateway) },
+			wantErr: "block: 502 Bad Gateway",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := rpctest.NewNode()
+			if tt.setup != nil {
+				tt.setup(n)
+			}
+			srv := rpctest.NewServer(n)
+			defer srv.Close()
+
+			c := NewProtocolMetrics(nearapi.NewClient(srv.URL), "")
+			err := testutil.CollectAndCompare(c, strings.NewReader(tt.want))
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
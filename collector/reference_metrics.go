@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReferenceMetrics compares the head of the node with the one of a reference
+// RPC, e.g. a public one, to catch nodes which report being synced but are
+// stuck.
+type ReferenceMetrics struct {
+	client              nearapi.RPC
+	referenceClient     nearapi.RPC
+	referenceHeightDesc *prometheus.Desc
+	lagDesc             *prometheus.Desc
+}
+
+func NewReferenceMetrics(client nearapi.RPC, referenceClient nearapi.RPC) *ReferenceMetrics {
+	return &ReferenceMetrics{
+		client:          client,
+		referenceClient: referenceClient,
+		referenceHeightDesc: prometheus.NewDesc(
+			"near_block_height_reference",
+			"The latest block height of the reference RPC",
+			nil,
+			nil,
+		),
+		lagDesc: prometheus.NewDesc(
+			"near_block_lag",
+			"The number of blocks the node is behind the reference RPC",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *ReferenceMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.referenceHeightDesc
+	ch <- collector.lagDesc
+}
+
+func (collector *ReferenceMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *ReferenceMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	ref, err := collector.referenceClient.GetContext(ctx, "status", nil)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.referenceHeightDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.lagDesc, err)
+		return
+	}
+	refHeight := ref.Status.SyncInfo.LatestBlockHeight
+	ch <- prometheus.MustNewConstMetric(collector.referenceHeightDesc, prometheus.GaugeValue, float64(refHeight))
+
+	sr, err := collector.client.GetContext(ctx, "status", nil)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.lagDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.lagDesc, prometheus.GaugeValue, float64(refHeight)-float64(sr.Status.SyncInfo.LatestBlockHeight))
+}
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RewardMetrics estimates the rewards of accountId for the current epoch the
+// way the protocol computes them: the epoch's inflation, without the
+// protocol treasury share, is split by stake among the current validators
+// and scaled down when the uptime is below the online thresholds. Delegators
+// receive the reward without the reward fee of the staking pool.
+type RewardMetrics struct {
+	client          nearapi.RPC
+	settings        Settings
+	accountId       string
+	blockId         string
+	epochRewardDesc *prometheus.Desc
+	feeRatioDesc    *prometheus.Desc
+	apyDesc         *prometheus.Desc
+}
+
+func NewRewardMetrics(client nearapi.RPC, accountId string, blockId string, settings Settings) *RewardMetrics {
+	return &RewardMetrics{
+		client:    client,
+		settings:  settings,
+		accountId: accountId,
+		blockId:   blockId,
+		epochRewardDesc: prometheus.NewDesc(
+			"near_account_estimated_epoch_reward",
+			"Estimated reward of a given account id for the current epoch at its current uptime, reward fee included",
+			[]string{"epoch"},
+			nil,
+		),
+		feeRatioDesc: prometheus.NewDesc(
+			"near_account_reward_fee_ratio",
+			"The share of the rewards the staking pool of a given account id keeps as fee",
+			nil,
+			nil,
+		),
+		apyDesc: prometheus.NewDesc(
+			"near_account_estimated_apy",
+			"Estimated annual yield of delegating to a given account id, compounded every epoch, after the reward fee",
+			[]string{"epoch"},
+			nil,
+		),
+	}
+}
+
+func (collector *RewardMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.epochRewardDesc
+	ch <- collector.feeRatioDesc
+	ch <- collector.apyDesc
+}
+
+func (collector *RewardMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *RewardMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var fee rewardFeeFraction
+	feeErr := callFunction(ctx, collector.client, collector.accountId, "get_reward_fee_fraction", map[string]string{}, collector.blockId, &fee)
+	if feeErr == nil && fee.Denominator == 0 {
+		feeErr = fmt.Errorf("reward fee fraction %d/0", fee.Numerator)
+	}
+	if feeErr != nil {
+		ch <- prometheus.NewInvalidMetric(collector.feeRatioDesc, feeErr)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.feeRatioDesc, prometheus.GaugeValue, float64(fee.Numerator)/float64(fee.Denominator))
+	}
+
+	var validatorsParams interface{} = "latest"
+	if collector.blockId != "" {
+		validatorsParams = []interface{}{BlockId(collector.blockId)}
+	}
+	r, err := collector.client.GetContext(ctx, "validators", validatorsParams)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.epochRewardDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.apyDesc, err)
+		return
+	}
+	pc, err := collector.client.GetContext(ctx, "EXPERIMENTAL_protocol_config", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.epochRewardDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.apyDesc, err)
+		return
+	}
+	b, err := collector.client.GetContext(ctx, "block", withBlockRef(map[string]interface{}{}, collector.blockId))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.epochRewardDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.apyDesc, err)
+		return
+	}
+	collector.collectRewards(ch, r, pc, b, fee, feeErr)
+}
+
+func (collector *RewardMetrics) collectRewards(ch chan<- prometheus.Metric, r *nearapi.Result, pc *nearapi.Result, b *nearapi.Result, fee rewardFeeFraction, feeErr error) {
+	epoch := fmt.Sprintf("%d", r.Validators.EpochHeight)
+	cfg := pc.ProtocolConfig
+	if cfg.NumBlocksPerYear == 0 || cfg.EpochLength == 0 {
+		err := fmt.Errorf("protocol config without num_blocks_per_year or epoch_length")
+		ch <- prometheus.NewInvalidMetric(collector.epochRewardDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.apyDesc, err)
+		return
+	}
+	totalSupplyYocto, err := ParseAmount(b.Block.Header.TotalSupply, YoctoNear)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.epochRewardDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.apyDesc, err)
+		return
+	}
+
+	totalSupply := ConvertAmount(totalSupplyYocto, collector.settings.Unit)
+	var totalStake, accountStake, uptime float64
+	isCurrentValidator := false
+	for _, v := range r.Validators.CurrentValidators {
+		stake := collector.settings.amount(v.Stake)
+		totalStake += stake
+		if v.AccountId == collector.accountId {
+			accountStake, uptime = stake, uptimeRatio(v)
+			isCurrentValidator = true
+		}
+	}
+	if !isCurrentValidator || accountStake == 0 {
+		return
+	}
+
+	epochsPerYear := float64(cfg.NumBlocksPerYear) / float64(cfg.EpochLength)
+	epochReward := totalSupply * cfg.MaxInflationRate.Float64() / epochsPerYear
+	validatorsReward := epochReward * (1 - cfg.ProtocolRewardRate.Float64())
+	reward := validatorsReward * onlineFactor(uptime, cfg.OnlineMinThreshold.Float64(), cfg.OnlineMaxThreshold.Float64()) * accountStake / totalStake
+	ch <- prometheus.MustNewConstMetric(collector.epochRewardDesc, prometheus.GaugeValue, reward, epoch)
+
+	if feeErr != nil {
+		ch <- prometheus.NewInvalidMetric(collector.apyDesc, feeErr)
+		return
+	}
+	delegatorsReward := reward * (1 - float64(fee.Numerator)/float64(fee.Denominator))
+	apy := math.Pow(1+delegatorsReward/accountStake, epochsPerYear) - 1
+	ch <- prometheus.MustNewConstMetric(collector.apyDesc, prometheus.GaugeValue, apy, epoch)
+}
+
+// onlineFactor scales the reward by the uptime: nothing below min, all of it
+// from max on and linearly in between.
+func onlineFactor(uptime float64, min float64, max float64) float64 {
+	switch {
+	case uptime < min:
+		return 0
+	case uptime >= max || max <= min:
+		return 1
+	}
+	return (uptime - min) / (max - min)
+}
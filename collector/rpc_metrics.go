@@ -1,150 +1,119 @@
 package collector
 
 import (
-	"encoding/json"
-	"fmt"
-	nearapi "github.com/masknetgoal634/near-exporter/client"
+	"context"
+	"strconv"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type NodeRpcMetrics struct {
-	accountId                 string
-	client                    *nearapi.Client
-	epochBlockProducedDesc    *prometheus.Desc
-	epochBlockExpectedDesc    *prometheus.Desc
-	epochChunksProducedDesc   *prometheus.Desc
-	epochChunksExpectedDesc   *prometheus.Desc
-	seatPriceDesc             *prometheus.Desc
-	delegatorStakeDesc        *prometheus.Desc
-	epochStartHeightDesc      *prometheus.Desc
-	blockNumberDesc           *prometheus.Desc
-	syncingDesc               *prometheus.Desc
-	versionBuildDesc          *prometheus.Desc
-	currentValidatorStakeDesc *prometheus.Desc
-	nextValidatorStakeDesc    *prometheus.Desc
-	prevEpochKickoutDesc      *prometheus.Desc
-	currentProposalsDesc      *prometheus.Desc
-}
-
-type DelegatorAccount struct {
-	AccountId       string `json:"account_id"`
-	UnstakedBalance string `json:"unstaked_balance"`
-	StakedBalance   string `json:"staked_balance"`
-	CanWithdraw     bool   `json:"can_withdraw"`
+	client             nearapi.RPC
+	versionBuildCompat bool
+	versionBuildHash   bool
+	exemplars          bool
+	blockNumberDesc    *prometheus.Desc
+	syncingDesc        *prometheus.Desc
+	versionBuildDesc   *prometheus.Desc
+	nodeInfoDesc       *prometheus.Desc
+	blockHeightDesc    *prometheus.Desc
+	protocolDesc       *prometheus.Desc
+	latestProtocolDesc *prometheus.Desc
+	upgradeNeededDesc  *prometheus.Desc
 }
 
-func NewNodeRpcMetrics(client *nearapi.Client, accountId string) *NodeRpcMetrics {
+// NewNodeRpcMetrics creates the node status collector. The deprecated
+// near_version_build metric is exported alongside near_node_info, which
+// carries the same information as labels, when versionBuildCompat is set. Its value is 1
+// unless versionBuildHash asks for the old FNV hash of the build. With
+// exemplars set the block height is also exported as a counter carrying the
+// block hash.
+func NewNodeRpcMetrics(client nearapi.RPC, versionBuildCompat bool, versionBuildHash bool, exemplars bool) *NodeRpcMetrics {
 	return &NodeRpcMetrics{
-		accountId: accountId,
-		client:    client,
-		epochBlockProducedDesc: prometheus.NewDesc(
-			"near_account_epoch_block_produced_number",
-			"The number of block produced in epoch of a given account id",
-			[]string{"epoch"},
-			nil,
-		),
-		epochBlockExpectedDesc: prometheus.NewDesc(
-			"near_account_epoch_block_expected_number",
-			"The number of block expected in epoch of a given account id",
-			[]string{"epoch"},
-			nil,
-		),
-		epochChunksProducedDesc: prometheus.NewDesc(
-			"near_account_epoch_chunks_produced_number",
-			"The number of chunks produced in epoch of a given account id",
-			[]string{"epoch"},
+		client:             client,
+		versionBuildCompat: versionBuildCompat,
+		versionBuildHash:   versionBuildHash,
+		exemplars:          exemplars,
+		blockNumberDesc: prometheus.NewDesc(
+			"near_block_number",
+			"The number of most recent block",
 			nil,
-		),
-		epochChunksExpectedDesc: prometheus.NewDesc(
-			"near_account_epoch_chunks_expected_number",
-			"The number of chunks expected in epoch of a given account id",
-			[]string{"epoch"},
 			nil,
 		),
-		delegatorStakeDesc: prometheus.NewDesc(
-			"near_account_delegator_stake",
-			"Delegators stake of a given account id",
-			[]string{"delegator_account_id", "epoch"},
+		syncingDesc: prometheus.NewDesc(
+			"near_sync_state",
+			"Sync state",
 			nil,
-		),
-		currentValidatorStakeDesc: prometheus.NewDesc(
-			"near_account_current_validator_stake",
-			"Current amount of validator stake of a given account id",
-			[]string{"epoch"},
 			nil,
 		),
-		nextValidatorStakeDesc: prometheus.NewDesc(
-			"near_account_next_validator_stake",
-			"The next validator stake of a given account id",
-			[]string{"epoch"},
+		versionBuildDesc: prometheus.NewDesc(
+			"near_version_build",
+			"The Near node version build, the value is always 1",
+			[]string{"version", "build"},
 			nil,
 		),
-		currentProposalsDesc: prometheus.NewDesc(
-			"near_account_current_proposals_stake",
-			"Current proposals of a given account id",
-			[]string{"epoch"},
+		nodeInfoDesc: prometheus.NewDesc(
+			"near_node_info",
+			"Near node information, the value is always 1",
+			[]string{"version", "build", "chain_id", "protocol_version"},
 			nil,
 		),
-		prevEpochKickoutDesc: prometheus.NewDesc(
-			"near_account_prev_epoch_kickout",
-			"Near previous epoch kicked out of a given account id",
-			[]string{"reason", "epoch"},
+		blockHeightDesc: prometheus.NewDesc(
+			"near_block_height_total",
+			"The height of most recent block, with the block hash as exemplar",
 			nil,
-		),
-		epochStartHeightDesc: prometheus.NewDesc(
-			"near_epoch_start_height",
-			"Near epoch start height",
-			[]string{"epoch"},
 			nil,
 		),
-		blockNumberDesc: prometheus.NewDesc(
-			"near_block_number",
-			"The number of most recent block",
+		protocolDesc: prometheus.NewDesc(
+			"near_protocol_version",
+			"The protocol version of the current epoch",
 			nil,
 			nil,
 		),
-		syncingDesc: prometheus.NewDesc(
-			"near_sync_state",
-			"Sync state",
+		latestProtocolDesc: prometheus.NewDesc(
+			"near_latest_protocol_version",
+			"The latest protocol version supported by the node",
 			nil,
 			nil,
 		),
-		versionBuildDesc: prometheus.NewDesc(
-			"near_version_build",
-			"The Near node version build",
-			[]string{"version", "build"},
+		upgradeNeededDesc: prometheus.NewDesc(
+			"near_protocol_upgrade_needed",
+			"Whether the node does not support the protocol version of the network, or the one voted for by the latest block producer",
 			nil,
-		),
-		seatPriceDesc: prometheus.NewDesc(
-			"near_seat_price",
-			"Validator seat price",
-			[]string{"epoch"},
 			nil,
 		),
 	}
 }
 
 func (collector *NodeRpcMetrics) Describe(ch chan<- *prometheus.Desc) {
-	ch <- collector.epochBlockProducedDesc
-	ch <- collector.epochBlockExpectedDesc
-	ch <- collector.epochChunksProducedDesc
-	ch <- collector.epochChunksExpectedDesc
-	ch <- collector.seatPriceDesc
-	ch <- collector.delegatorStakeDesc
-	ch <- collector.epochStartHeightDesc
 	ch <- collector.blockNumberDesc
 	ch <- collector.syncingDesc
-	ch <- collector.versionBuildDesc
-	ch <- collector.currentValidatorStakeDesc
-	ch <- collector.nextValidatorStakeDesc
-	ch <- collector.currentProposalsDesc
-	ch <- collector.prevEpochKickoutDesc
+	if collector.versionBuildCompat {
+		ch <- collector.versionBuildDesc
+	}
+	ch <- collector.nodeInfoDesc
+	ch <- collector.protocolDesc
+	ch <- collector.latestProtocolDesc
+	ch <- collector.upgradeNeededDesc
+	if collector.exemplars {
+		ch <- collector.blockHeightDesc
+	}
 }
 
 func (collector *NodeRpcMetrics) Collect(ch chan<- prometheus.Metric) {
-	sr, err := collector.client.Get("status", nil)
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *NodeRpcMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	sr, err := collector.client.GetContext(ctx, "status", nil)
 	if err != nil {
-		ch <- prometheus.NewInvalidMetric(collector.versionBuildDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.blockNumberDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.syncingDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.nodeInfoDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.protocolDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.latestProtocolDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.upgradeNeededDesc, err)
 		return
 	}
 	syn := sr.Status.SyncInfo.Syncing
@@ -158,88 +127,36 @@ func (collector *NodeRpcMetrics) Collect(ch chan<- prometheus.Metric) {
 
 	blockHeight := sr.Status.SyncInfo.LatestBlockHeight
 	ch <- prometheus.MustNewConstMetric(collector.blockNumberDesc, prometheus.GaugeValue, float64(blockHeight))
-
-	versionBuildInt := HashString(sr.Status.Version.Build)
-	ch <- prometheus.MustNewConstMetric(collector.versionBuildDesc, prometheus.GaugeValue, float64(versionBuildInt), sr.Status.Version.Version, sr.Status.Version.Build)
-
-	r, err := collector.client.Get("validators", "latest")
-	if err != nil {
-		ch <- prometheus.NewInvalidMetric(collector.epochBlockProducedDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.epochBlockExpectedDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.epochChunksProducedDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.epochChunksExpectedDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.seatPriceDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.epochStartHeightDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.blockNumberDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.syncingDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.versionBuildDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.currentValidatorStakeDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.nextValidatorStakeDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.currentProposalsDesc, err)
-		ch <- prometheus.NewInvalidMetric(collector.prevEpochKickoutDesc, err)
-		return
+	if collector.exemplars {
+		ch <- mustNewCounterWithExemplar(collector.blockHeightDesc, float64(blockHeight), prometheus.Labels{
+			"block_hash":   sr.Status.SyncInfo.LatestBlockHash,
+			"block_height": strconv.FormatUint(blockHeight, 10),
+		})
 	}
 
-	epoch := r.Validators.EpochHeight
-	ch <- prometheus.MustNewConstMetric(collector.epochStartHeightDesc, prometheus.GaugeValue, float64(r.Validators.EpochStartHeight), fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.nodeInfoDesc, prometheus.GaugeValue, 1,
+		sr.Status.Version.Version, sr.Status.Version.Build, sr.Status.ChainId, strconv.Itoa(sr.Status.ProtocolVersion))
 
-	var seatPrice float64
-	for _, v := range r.Validators.CurrentValidators {
-		stake := GetStakeFromString(v.Stake)
-		if seatPrice == 0 {
-			seatPrice = stake
-		}
-		if seatPrice > stake {
-			seatPrice = stake
-		}
-		if v.AccountId == collector.accountId {
-			ch <- prometheus.MustNewConstMetric(collector.currentValidatorStakeDesc, prometheus.GaugeValue, stake, fmt.Sprintf("%d", epoch))
-			ch <- prometheus.MustNewConstMetric(collector.epochBlockProducedDesc, prometheus.GaugeValue, float64(v.NumProducedBlocks), fmt.Sprintf("%d", epoch))
-			ch <- prometheus.MustNewConstMetric(collector.epochBlockExpectedDesc, prometheus.GaugeValue, float64(v.NumExpectedBlocks), fmt.Sprintf("%d", epoch))
-			ch <- prometheus.MustNewConstMetric(collector.epochChunksProducedDesc, prometheus.GaugeValue, float64(v.NumProducedChunks), fmt.Sprintf("%d", epoch))
-			ch <- prometheus.MustNewConstMetric(collector.epochChunksExpectedDesc, prometheus.GaugeValue, float64(v.NumExpectedChunks), fmt.Sprintf("%d", epoch))
-		}
-	}
-	ch <- prometheus.MustNewConstMetric(collector.seatPriceDesc, prometheus.GaugeValue, seatPrice, fmt.Sprintf("%d", epoch))
-	for _, v := range r.Validators.NextValidators {
-		if v.AccountId == collector.accountId {
-			ch <- prometheus.MustNewConstMetric(collector.nextValidatorStakeDesc, prometheus.GaugeValue, GetStakeFromString(v.Stake), fmt.Sprintf("%d", epoch))
-		}
-	}
+	ch <- prometheus.MustNewConstMetric(collector.protocolDesc, prometheus.GaugeValue, float64(sr.Status.ProtocolVersion))
+	ch <- prometheus.MustNewConstMetric(collector.latestProtocolDesc, prometheus.GaugeValue, float64(sr.Status.LatestProtocolVersion))
 
-	for _, v := range r.Validators.CurrentProposals {
-		if v.AccountId == collector.accountId {
-			ch <- prometheus.MustNewConstMetric(collector.currentProposalsDesc, prometheus.GaugeValue, GetStakeFromString(v.Stake), fmt.Sprintf("%d", epoch))
+	// Block headers carry the protocol version voted for by their producer,
+	// which becomes the network's version once enough stake voted for it.
+	if b, err := collector.client.GetContext(ctx, "block", withBlockRef(map[string]interface{}{}, "")); err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.upgradeNeededDesc, err)
+	} else {
+		networkVersion := sr.Status.ProtocolVersion
+		if v := int(b.Block.Header.LatestProtocolVersion); v > networkVersion {
+			networkVersion = v
 		}
+		ch <- prometheus.MustNewConstMetric(collector.upgradeNeededDesc, prometheus.GaugeValue, boolToFloat(sr.Status.LatestProtocolVersion < networkVersion))
 	}
 
-	for _, v := range r.Validators.PrevEpochKickOut {
-		if v.AccountId == collector.accountId {
-			ch <- prometheus.MustNewConstMetric(collector.prevEpochKickoutDesc, prometheus.GaugeValue, 0, fmt.Sprintf("%v", v.Reason), fmt.Sprintf("%d", epoch))
+	if collector.versionBuildCompat {
+		var versionBuild float64 = 1
+		if collector.versionBuildHash {
+			versionBuild = float64(HashString(sr.Status.Version.Build))
 		}
+		ch <- prometheus.MustNewConstMetric(collector.versionBuildDesc, prometheus.GaugeValue, versionBuild, sr.Status.Version.Version, sr.Status.Version.Build)
 	}
-
-	d, err := collector.client.Get("query", map[string]interface{}{"request_type": "call_function",
-		"finality":    "final",
-		"account_id":  collector.accountId,
-		"method_name": "get_accounts",
-		"args_base64": "eyJmcm9tX2luZGV4IjogMCwgImxpbWl0IjogMTAwfQ=="})
-
-	if err != nil {
-		ch <- prometheus.NewInvalidMetric(collector.delegatorStakeDesc, err)
-		return
-	}
-
-	resultString := ""
-	for _, n := range d.Result.Result {
-		resultString += string(n)
-
-	}
-	res := []DelegatorAccount{}
-	_ = json.Unmarshal([]byte(resultString), &res)
-
-	for _, delegator := range res {
-		ch <- prometheus.MustNewConstMetric(collector.delegatorStakeDesc, prometheus.GaugeValue, GetStakeFromString(delegator.StakedBalance), delegator.AccountId, fmt.Sprintf("%d", epoch))
-	}
-
 }
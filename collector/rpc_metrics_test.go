@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const nodeMetrics = `
+# HELP near_block_number The number of most recent block
+# TYPE near_block_number gauge
+near_block_number 1000000
+# HELP near_sync_state Sync state
+# TYPE near_sync_state gauge
+near_sync_state 0
+# HELP near_node_info Near node information, the value is always 1
+# TYPE near_node_info gauge
+near_node_info{build="rpctest",chain_id="testnet",protocol_version="60",version="1.0.0"} 1
+# HELP near_protocol_version The protocol version of the current epoch
+# TYPE near_protocol_version gauge
+near_protocol_version 60
+# HELP near_latest_protocol_version The latest protocol version supported by the node
+# TYPE near_latest_protocol_version gauge
+near_latest_protocol_version 60
+`
+
+const upgradeNeededHelp = `
+# HELP near_protocol_upgrade_needed Whether the node does not support the protocol version of the network, or the one voted for by the latest block producer
+# TYPE near_protocol_upgrade_needed gauge
+`
+
+func TestNodeRpcMetricsCollect(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(n *rpctest.Node)
+		versionBuild bool
+		want         string
+		wantErr      string
+	}{
+		{
+			name: "status",
+			want: nodeMetrics + upgradeNeededHelp + "near_protocol_upgrade_needed 0\n",
+		},
+		{
+			name:         "version build",
+			versionBuild: true,
+			want: nodeMetrics + upgradeNeededHelp + "near_protocol_upgrade_needed 0\n" + `
+# HELP near_version_build The Near node version build, the value is always 1
+# TYPE near_version_build gauge
+near_version_build{build="rpctest",version="1.0.0"} 1
+`,
+		},
+		{
+			name: "newer protocol voted",
+			setup: func(n *rpctest.Node) {
+				n.SetResult("block", map[string]interface{}{"header": map[string]interface{}{"latest_protocol_version": 61}})
+			},
+			want: nodeMetrics + upgradeNeededHelp + "near_protocol_upgrade_needed 1\n",
+		},
+		{
+			name:    "status HTTP error",
+			setup:   func(n *rpctest.Node) { n.Fail("status", http.StatusInternalServerError) },
+			wantErr: "status: 500 Internal Server Error",
+		},
+		{
+			name: "status JSON-RPC error",
+			setup: func(n *rpctest.Node) {
+				n.Handle("status", func(json.RawMessage) (interface{}, error) { return nil, errors.New("node is starting") })
+			},
+			wantErr: "Server error: node is starting",
+		},
+		{
+			name:    "malformed status",
+			setup:   func(n *rpctest.Node) { n.SetResult("status", "garbage") },
+			wantErr: "cannot unmarshal string",
+		},
+		{
+			name:    "block error",
+			setup:   func(n *rpctest.Node) { n.Fail("block", http.StatusBadGateway) },
+			wantErr: "block: 502 Bad Gateway",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := rpctest.NewNode()
+			if tt.setup != nil {
+				tt.setup(n)
+			}
+			srv := rpctest.NewServer(n)
+			defer srv.Close()
+
+			c := NewNodeRpcMetrics(nearapi.NewClient(srv.URL), tt.versionBuild, false, false)
+			err := testutil.CollectAndCompare(c, strings.NewReader(tt.want))
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
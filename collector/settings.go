@@ -0,0 +1,49 @@
+package collector
+
+// Defaults of the Settings fields.
+const (
+	DefaultWhitelistAccountId = "whitelist.near"
+	DefaultDelegatorsPageSize = 100
+	DefaultMaxDelegators      = 100000
+)
+
+// Settings are the options of the collectors which export amounts or read
+// staking pools. Every collector keeps the settings it was created with, so
+// collectors with different settings can run side by side.
+type Settings struct {
+	// Unit is the unit stakes and balances are exported in, NEAR by
+	// default.
+	Unit Unit
+	// RawYocto additionally exports stakes and balances in yoctoNEAR, as
+	// metrics named like the ones in Unit with a _yocto suffix.
+	RawYocto bool
+	// WhitelistAccountId is the staking pool whitelist contract consulted by
+	// lockup contracts, DefaultWhitelistAccountId on mainnet. The check is
+	// skipped when it is empty or the contract does not exist.
+	WhitelistAccountId string
+	// DelegatorsPageSize is the number of delegators requested per
+	// get_accounts call, DefaultDelegatorsPageSize if 0. At most
+	// MaxDelegators, DefaultMaxDelegators if 0, are read from a staking pool.
+	DelegatorsPageSize int
+	MaxDelegators      int
+}
+
+// amount converts a yoctoNEAR amount to the export unit, 0 if it is empty or
+// invalid.
+func (s Settings) amount(yocto string) float64 {
+	return GetStakeFromString(yocto, s.Unit)
+}
+
+func (s Settings) delegatorsPageSize() int {
+	if s.DelegatorsPageSize <= 0 {
+		return DefaultDelegatorsPageSize
+	}
+	return s.DelegatorsPageSize
+}
+
+func (s Settings) maxDelegators() int {
+	if s.MaxDelegators <= 0 {
+		return DefaultMaxDelegators
+	}
+	return s.MaxDelegators
+}
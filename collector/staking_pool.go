@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+)
+
+// callFunction calls a view method of the contract deployed on accountId and
+// decodes the JSON result into res.
+func callFunction(ctx context.Context, client nearapi.RPC, accountId string, method string, args interface{}, blockId string, res interface{}) error {
+	argsJson, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	d, err := client.GetContext(ctx, "query", withBlockRef(map[string]interface{}{"request_type": "call_function",
+		"account_id":  accountId,
+		"method_name": method,
+		"args_base64": base64.StdEncoding.EncodeToString(argsJson)}, blockId))
+	if err != nil {
+		return err
+	}
+
+	resultString := ""
+	for _, n := range d.Result.Result {
+		resultString += string(n)
+	}
+	return json.Unmarshal([]byte(resultString), res)
+}
+
+// isUnknownAccount reports whether err is the RPC error of a query of an
+// account which does not exist.
+func isUnknownAccount(err error) bool {
+	var rpcErr *nearapi.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	data, _ := rpcErr.Data.(string)
+	return rpcErr.Cause.Name == "UNKNOWN_ACCOUNT" || strings.Contains(data, "does not exist")
+}
+
+func getAccounts(ctx context.Context, client nearapi.RPC, accountId string, blockId string, fromIndex int, limit int) ([]DelegatorAccount, error) {
+	res := []DelegatorAccount{}
+	err := callFunction(ctx, client, accountId, "get_accounts", map[string]int{"from_index": fromIndex, "limit": limit}, blockId, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// getAccount returns the balances of delegatorId in the staking pool poolId.
+func getAccount(ctx context.Context, client nearapi.RPC, poolId string, delegatorId string, blockId string) (DelegatorAccount, error) {
+	var res DelegatorAccount
+	err := callFunction(ctx, client, poolId, "get_account", map[string]string{"account_id": delegatorId}, blockId, &res)
+	return res, err
+}
+
+// getAllAccounts pages through get_accounts until the staking pool returns
+// a short page or the maximum number of delegators of settings are read.
+func getAllAccounts(ctx context.Context, client nearapi.RPC, accountId string, blockId string, settings Settings) ([]DelegatorAccount, error) {
+	var res []DelegatorAccount
+	max := settings.maxDelegators()
+	for {
+		limit := settings.delegatorsPageSize()
+		if max-len(res) < limit {
+			limit = max - len(res)
+		}
+		if limit <= 0 {
+			logging.Warn("stopped reading delegators at the limit", "account_id", accountId, "limit", max)
+			return res, nil
+		}
+		page, err := getAccounts(ctx, client, accountId, blockId, len(res), limit)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page...)
+		if len(page) < limit {
+			return res, nil
+		}
+	}
+}
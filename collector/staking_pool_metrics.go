@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type rewardFeeFraction struct {
+	Numerator   int64 `json:"numerator"`
+	Denominator int64 `json:"denominator"`
+}
+
+// StakingPoolMetrics exports the state of the staking pool contract deployed
+// on accountId.
+type StakingPoolMetrics struct {
+	client               nearapi.RPC
+	settings             Settings
+	accountId            string
+	blockId              string
+	feeNumeratorDesc     *prometheus.Desc
+	feeDenominatorDesc   *prometheus.Desc
+	totalStakedDesc      *prometheus.Desc
+	accountsCountDesc    *prometheus.Desc
+	totalStakedYoctoDesc *prometheus.Desc
+}
+
+func NewStakingPoolMetrics(client nearapi.RPC, accountId string, blockId string, settings Settings) *StakingPoolMetrics {
+	return &StakingPoolMetrics{
+		client:    client,
+		settings:  settings,
+		accountId: accountId,
+		blockId:   blockId,
+		feeNumeratorDesc: prometheus.NewDesc(
+			"near_pool_reward_fee_numerator",
+			"Numerator of the reward fee fraction of the staking pool",
+			nil,
+			nil,
+		),
+		feeDenominatorDesc: prometheus.NewDesc(
+			"near_pool_reward_fee_denominator",
+			"Denominator of the reward fee fraction of the staking pool",
+			nil,
+			nil,
+		),
+		totalStakedDesc: prometheus.NewDesc(
+			"near_pool_total_staked_balance",
+			"Total staked balance of the staking pool",
+			nil,
+			nil,
+		),
+		totalStakedYoctoDesc: yoctoDesc("near_pool_total_staked_balance", "Total staked balance of the staking pool", nil),
+		accountsCountDesc: prometheus.NewDesc(
+			"near_pool_accounts_count",
+			"The number of accounts of the staking pool",
+			[]string{"owner_id"},
+			nil,
+		),
+	}
+}
+
+func (collector *StakingPoolMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.feeNumeratorDesc
+	ch <- collector.feeDenominatorDesc
+	ch <- collector.totalStakedDesc
+	ch <- collector.accountsCountDesc
+	if collector.settings.RawYocto {
+		ch <- collector.totalStakedYoctoDesc
+	}
+}
+
+func (collector *StakingPoolMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *StakingPoolMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var fee rewardFeeFraction
+	if err := callFunction(ctx, collector.client, collector.accountId, "get_reward_fee_fraction", map[string]string{}, collector.blockId, &fee); err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.feeNumeratorDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.feeDenominatorDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.feeNumeratorDesc, prometheus.GaugeValue, float64(fee.Numerator))
+		ch <- prometheus.MustNewConstMetric(collector.feeDenominatorDesc, prometheus.GaugeValue, float64(fee.Denominator))
+	}
+
+	var totalStaked string
+	if err := callFunction(ctx, collector.client, collector.accountId, "get_total_staked_balance", map[string]string{}, collector.blockId, &totalStaked); err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.totalStakedDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.totalStakedDesc, prometheus.GaugeValue, collector.settings.amount(totalStaked))
+		if collector.settings.RawYocto {
+			ch <- mustNewYoctoMetric(collector.totalStakedYoctoDesc, totalStaked)
+		}
+	}
+
+	var ownerId string
+	var accounts int64
+	err := callFunction(ctx, collector.client, collector.accountId, "get_owner_id", map[string]string{}, collector.blockId, &ownerId)
+	if err == nil {
+		err = callFunction(ctx, collector.client, collector.accountId, "get_number_of_accounts", map[string]string{}, collector.blockId, &accounts)
+	}
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.accountsCountDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.accountsCountDesc, prometheus.GaugeValue, float64(accounts), ownerId)
+}
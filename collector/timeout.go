@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ContextCollector is a collector which can be aborted. CollectContext
+// collects like Collect, aborting the RPC calls when ctx is done. All RPC
+// collectors of this package implement it, Collect calls CollectContext with
+// a background context.
+type ContextCollector interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+var deadlineDesc = prometheus.NewDesc(
+	"near_exporter_collector_deadline_exceeded",
+	"A collection was aborted at the scrape deadline",
+	nil,
+	nil,
+)
+
+// timeoutCollector aborts a collection after timeout. The metrics collected
+// until then are returned together with an invalid metric, so that the
+// collection counts as failed. The aborted collection returns in the
+// background once its RPC calls noticed the cancellation.
+type timeoutCollector struct {
+	ContextCollector
+	timeout   time.Duration
+	onTimeout func()
+}
+
+// WithTimeout aborts the collections of c after timeout, if c is a
+// ContextCollector and timeout is positive. onTimeout, if not nil, is called
+// for every aborted collection.
+func WithTimeout(c prometheus.Collector, timeout time.Duration, onTimeout func()) prometheus.Collector {
+	cc, ok := c.(ContextCollector)
+	if !ok || timeout <= 0 {
+		return c
+	}
+	return &timeoutCollector{ContextCollector: cc, timeout: timeout, onTimeout: onTimeout}
+}
+
+func (c *timeoutCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(context.Background(), ch)
+}
+
+func (c *timeoutCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	metrics := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		c.ContextCollector.CollectContext(ctx, metrics)
+		close(done)
+	}()
+	for {
+		select {
+		case m := <-metrics:
+			ch <- m
+		case <-done:
+			return
+		case <-ctx.Done():
+			// The aborted RPC calls still report invalid metrics, which are
+			// dropped.
+			go func() {
+				for {
+					select {
+					case <-metrics:
+					case <-done:
+						return
+					}
+				}
+			}()
+			if c.onTimeout != nil {
+				c.onTimeout()
+			}
+			ch <- prometheus.NewInvalidMetric(deadlineDesc, fmt.Errorf("deadline of %s exceeded", c.timeout))
+			return
+		}
+	}
+}
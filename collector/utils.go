@@ -1,23 +1,52 @@
 package collector
 
 import (
-	"fmt"
 	"hash/fnv"
 	"math"
+	"math/big"
 	"strconv"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func GetStakeFromString(s string) float64 {
-	if len(s) <= 19 {
+// YoctoToNear converts a yoctoNEAR amount to NEAR.
+func YoctoToNear(s string) (float64, error) {
+	yocto, err := ParseAmount(s, YoctoNear)
+	if err != nil {
+		return 0, err
+	}
+	return ConvertAmount(yocto, Near), nil
+}
+
+// GetStakeFromString converts a yoctoNEAR amount to unit, 0 if it is empty
+// or invalid.
+func GetStakeFromString(s string, unit Unit) float64 {
+	if s == "" {
 		return 0
 	}
-	l := len(s) - 19
-	v, err := strconv.ParseFloat(s[0:l], 64)
+	yocto, err := ParseAmount(s, YoctoNear)
 	if err != nil {
-		fmt.Println(err)
+		logging.Warn("invalid amount", "err", err)
 		return 0
 	}
-	return v / math.Pow(10, 5)
+	return ConvertAmount(yocto, unit)
+}
+
+// yoctoDesc returns the desc of the yoctoNEAR variant of a metric.
+func yoctoDesc(name string, help string, variableLabels []string) *prometheus.Desc {
+	return prometheus.NewDesc(name+"_yocto", help+" in yoctoNEAR", variableLabels, nil)
+}
+
+// mustNewYoctoMetric creates a gauge with the yoctoNEAR amount s. Amounts
+// above 2^53 yoctoNEAR are rounded to float64 precision.
+func mustNewYoctoMetric(desc *prometheus.Desc, s string, labelValues ...string) prometheus.Metric {
+	var v float64
+	if yocto, err := ParseAmount(s, YoctoNear); err == nil {
+		v, _ = new(big.Float).SetInt(yocto).Float64()
+	}
+	return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labelValues...)
 }
 
 func HashString(s string) uint32 {
@@ -25,3 +54,74 @@ func HashString(s string) uint32 {
 	h.Write([]byte(s))
 	return h.Sum32()
 }
+
+// invalidMetrics reports err for every desc c describes, so that a failed
+// collection fails all of its metrics.
+func invalidMetrics(c prometheus.Collector, ch chan<- prometheus.Metric, err error) {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+	for desc := range descs {
+		ch <- prometheus.NewInvalidMetric(desc, err)
+	}
+}
+
+// BlockId converts a block height or hash into the value expected by the
+// block_id parameter of the JSON-RPC API.
+func BlockId(s string) interface{} {
+	if height, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return height
+	}
+	return s
+}
+
+// withBlockRef pins the query params to the given block height or hash, or
+// to the latest final block when blockId is empty.
+func withBlockRef(params map[string]interface{}, blockId string) map[string]interface{} {
+	if blockId == "" {
+		params["finality"] = "final"
+	} else {
+		params["block_id"] = BlockId(blockId)
+	}
+	return params
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// productivityRatio returns produced/expected, 1 when nothing was expected.
+func productivityRatio(produced int64, expected int64) float64 {
+	if expected == 0 {
+		return 1
+	}
+	return float64(produced) / float64(expected)
+}
+
+// uptimeRatio averages the block and chunk productivity like the NEAR reward
+// calculator, ignoring the kind of which nothing was expected.
+func uptimeRatio(v nearapi.CurrentValidator) float64 {
+	switch {
+	case v.NumExpectedBlocks == 0 && v.NumExpectedChunks == 0:
+		return 1
+	case v.NumExpectedBlocks == 0:
+		return productivityRatio(v.NumProducedChunks, v.NumExpectedChunks)
+	case v.NumExpectedChunks == 0:
+		return productivityRatio(v.NumProducedBlocks, v.NumExpectedBlocks)
+	}
+	return (productivityRatio(v.NumProducedBlocks, v.NumExpectedBlocks) + productivityRatio(v.NumProducedChunks, v.NumExpectedChunks)) / 2
+}
+
+// kickoutMargin returns by how much the productivity of v exceeds the kickout
+// thresholds, given in percent as in the protocol config. It is negative when
+// the validator is below a threshold.
+func kickoutMargin(v nearapi.CurrentValidator, blockThreshold int, chunkThreshold int) float64 {
+	blockMargin := productivityRatio(v.NumProducedBlocks, v.NumExpectedBlocks) - float64(blockThreshold)/100
+	chunkMargin := productivityRatio(v.NumProducedChunks, v.NumExpectedChunks) - float64(chunkThreshold)/100
+	return math.Min(blockMargin, chunkMargin)
+}
@@ -0,0 +1,56 @@
+package collector
+
+import "testing"
+
+func TestYoctoToNear(t *testing.T) {
+	tests := []struct {
+		yocto   string
+		want    float64
+		wantErr bool
+	}{
+		{yocto: "0", want: 0},
+		{yocto: "1", want: 1e-24},
+		{yocto: "9999999999999999999", want: 9.999999999999999999e-6},
+		{yocto: "1000000000000000000000000", want: 1},
+		{yocto: "1000000000000000000000000000000000", want: 1e9},
+		{yocto: "123456789012345678901234567890123", want: 123456789.012345678901234567890123},
+		{yocto: "", wantErr: true},
+		{yocto: "12 apples", wantErr: true},
+		{yocto: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := YoctoToNear(tt.yocto)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("YoctoToNear(%q) error = %v, want error %v", tt.yocto, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("YoctoToNear(%q) = %v, want %v", tt.yocto, got, tt.want)
+		}
+	}
+}
+
+func TestGetStakeFromString(t *testing.T) {
+	tests := []struct {
+		yocto string
+		unit  Unit
+		want  float64
+	}{
+		{"0", Near, 0},
+		{"9999999999999999999", Near, 9.999999999999999999e-6},
+		{"9999999999999999999", MilliNear, 9.999999999999999999e-3},
+		{"9999999999999999999", YoctoNear, 9999999999999999999},
+		{"1000000000000000000000000000000000", Near, 1e9},
+		{"1000000000000000000000000000000000", MilliNear, 1e12},
+		{"1000000000000000000000000000000000", YoctoNear, 1e33},
+		{"123456789012345678901234567890123", Near, 123456789.012345678901234567890123},
+		{"", Near, 0},
+		{"", YoctoNear, 0},
+		{"not a number", Near, 0},
+		{"0x10", YoctoNear, 0},
+	}
+	for _, tt := range tests {
+		if got := GetStakeFromString(tt.yocto, tt.unit); got != tt.want {
+			t.Errorf("GetStakeFromString(%q, %s) = %v, want %v", tt.yocto, tt.unit, got, tt.want)
+		}
+	}
+}
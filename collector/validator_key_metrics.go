@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"context"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ValidatorKeyMetrics checks that the node validates with the key the
+// monitored account stakes with. A node restarted with a wrong
+// validator_key.json silently stops producing blocks.
+type ValidatorKeyMetrics struct {
+	nodeClient   nearapi.RPC
+	client       nearapi.RPC
+	accountId    string
+	blockId      string
+	mismatchDesc *prometheus.Desc
+}
+
+func NewValidatorKeyMetrics(nodeClient nearapi.RPC, client nearapi.RPC, accountId string, blockId string) *ValidatorKeyMetrics {
+	return &ValidatorKeyMetrics{
+		nodeClient: nodeClient,
+		client:     client,
+		accountId:  accountId,
+		blockId:    blockId,
+		mismatchDesc: prometheus.NewDesc(
+			"near_account_key_mismatch",
+			"Whether the validator account or key of the node differs from the one staked with by a given account id",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *ValidatorKeyMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.mismatchDesc
+}
+
+func (collector *ValidatorKeyMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *ValidatorKeyMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	sr, err := collector.nodeClient.GetContext(ctx, "status", nil)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.mismatchDesc, err)
+		return
+	}
+	var validatorsParams interface{} = "latest"
+	if collector.blockId != "" {
+		validatorsParams = []interface{}{BlockId(collector.blockId)}
+	}
+	r, err := collector.client.GetContext(ctx, "validators", validatorsParams)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.mismatchDesc, err)
+		return
+	}
+
+	mismatch := sr.Status.ValidatorAccountId != collector.accountId
+	if key, ok := stakingKey(r, collector.accountId); ok && key != sr.Status.ValidatorPublicKey {
+		mismatch = true
+	}
+	ch <- prometheus.MustNewConstMetric(collector.mismatchDesc, prometheus.GaugeValue, boolToFloat(mismatch))
+}
+
+// stakingKey returns the key accountId validates with in the current epoch,
+// or else in the next epoch or its latest proposal.
+func stakingKey(r *nearapi.Result, accountId string) (string, bool) {
+	for _, v := range r.Validators.CurrentValidators {
+		if v.AccountId == accountId {
+			return v.PublicKey, true
+		}
+	}
+	for _, v := range r.Validators.NextValidators {
+		if v.AccountId == accountId {
+			return v.PublicKey, true
+		}
+	}
+	if v, ok := findProposal(r, accountId); ok {
+		return v.PublicKey, true
+	}
+	return "", false
+}
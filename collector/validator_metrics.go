@@ -0,0 +1,830 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Unstaked balance in a staking pool is locked for this many epochs.
+const numEpochsToUnlock = 4
+
+type pendingUnstake struct {
+	unstaked float64
+	epoch    int64
+}
+
+type ValidatorMetrics struct {
+	mu             sync.Mutex
+	pendingUnstake map[string]*pendingUnstake
+	// kickouts counts the kickouts seen by reason, lastKickoutEpoch avoids
+	// counting a kickout again on every scrape of the following epoch.
+	kickouts         map[string]float64
+	lastKickoutEpoch int64
+	// delegatorStakes are the staked balances of the previous scrape, nil
+	// before the first one.
+	delegatorStakes map[string]float64
+	deposits        float64
+	withdrawals     float64
+	production      *ProductionState
+
+	accountId                 string
+	blockId                   string
+	exemplars                 bool
+	allProposals              bool
+	client                    nearapi.RPC
+	settings                  Settings
+	epochBlockProducedDesc    *prometheus.Desc
+	epochBlockExpectedDesc    *prometheus.Desc
+	epochChunksProducedDesc   *prometheus.Desc
+	epochChunksExpectedDesc   *prometheus.Desc
+	seatPriceDesc             *prometheus.Desc
+	nextSeatPriceDesc         *prometheus.Desc
+	proposalsSeatPriceDesc    *prometheus.Desc
+	delegatorStakeDesc        *prometheus.Desc
+	epochStartHeightDesc      *prometheus.Desc
+	currentValidatorStakeDesc *prometheus.Desc
+	nextValidatorStakeDesc    *prometheus.Desc
+	prevEpochKickoutDesc      *prometheus.Desc
+	kickoutProducedDesc       *prometheus.Desc
+	kickoutExpectedDesc       *prometheus.Desc
+	kickoutStakeDesc          *prometheus.Desc
+	kickoutThresholdDesc      *prometheus.Desc
+	kickoutsDesc              *prometheus.Desc
+	currentProposalsDesc      *prometheus.Desc
+	currentStakeYoctoDesc     *prometheus.Desc
+	nextStakeYoctoDesc        *prometheus.Desc
+	proposalsStakeYoctoDesc   *prometheus.Desc
+	epochHeightDesc           *prometheus.Desc
+	seatsOccupiedDesc         *prometheus.Desc
+	proposalStakeDesc         *prometheus.Desc
+	projectedStakeDesc        *prometheus.Desc
+	pendingWithdrawalDesc     *prometheus.Desc
+	pendingDelegatorsDesc     *prometheus.Desc
+	withdrawalEpochDesc       *prometheus.Desc
+	withdrawalHeightDesc      *prometheus.Desc
+	whitelistedDesc           *prometheus.Desc
+	blockProductivityDesc     *prometheus.Desc
+	chunkProductivityDesc     *prometheus.Desc
+	uptimeDesc                *prometheus.Desc
+	kickoutRiskDesc           *prometheus.Desc
+	isCurrentDesc             *prometheus.Desc
+	isNextDesc                *prometheus.Desc
+	hasProposalDesc           *prometheus.Desc
+	currentCountDesc          *prometheus.Desc
+	nextCountDesc             *prometheus.Desc
+	rankDesc                  *prometheus.Desc
+	delegatorsDesc            *prometheus.Desc
+	delegatedStakeDesc        *prometheus.Desc
+	unstakedBalanceDesc       *prometheus.Desc
+	canWithdrawDesc           *prometheus.Desc
+	depositsDesc              *prometheus.Desc
+	withdrawalsDesc           *prometheus.Desc
+	stakeChangeDesc           *prometheus.Desc
+	blocksProducedTotalDesc   *prometheus.Desc
+	blocksExpectedTotalDesc   *prometheus.Desc
+	chunksProducedTotalDesc   *prometheus.Desc
+	chunksExpectedTotalDesc   *prometheus.Desc
+}
+
+type DelegatorAccount struct {
+	AccountId       string `json:"account_id"`
+	UnstakedBalance string `json:"unstaked_balance"`
+	StakedBalance   string `json:"staked_balance"`
+	CanWithdraw     bool   `json:"can_withdraw"`
+}
+
+// NewValidatorMetrics creates the validator collector for accountId. When
+// blockId is not empty all queries are pinned to that block height or hash.
+// With exemplars set the epoch height is also exported as a counter carrying
+// the epoch start height. With allProposals set the stake of every current
+// proposal is exported, not only the one of accountId. The produced and
+// expected counts across epochs are accumulated in production, a new
+// in-memory state if nil.
+func NewValidatorMetrics(client nearapi.RPC, accountId string, blockId string, exemplars bool, allProposals bool, production *ProductionState, settings Settings) *ValidatorMetrics {
+	if production == nil {
+		production, _ = NewProductionState("")
+	}
+	return &ValidatorMetrics{
+		production:       production,
+		pendingUnstake:   make(map[string]*pendingUnstake),
+		kickouts:         make(map[string]float64),
+		lastKickoutEpoch: -1,
+		accountId:        accountId,
+		blockId:          blockId,
+		exemplars:        exemplars,
+		allProposals:     allProposals,
+		client:           client,
+		settings:         settings,
+		epochBlockProducedDesc: prometheus.NewDesc(
+			"near_account_epoch_block_produced_number",
+			"The number of block produced in epoch of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		epochBlockExpectedDesc: prometheus.NewDesc(
+			"near_account_epoch_block_expected_number",
+			"The number of block expected in epoch of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		epochChunksProducedDesc: prometheus.NewDesc(
+			"near_account_epoch_chunks_produced_number",
+			"The number of chunks produced in epoch of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		epochChunksExpectedDesc: prometheus.NewDesc(
+			"near_account_epoch_chunks_expected_number",
+			"The number of chunks expected in epoch of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		blockProductivityDesc: prometheus.NewDesc(
+			"near_account_block_productivity_ratio",
+			"Ratio of produced to expected blocks in epoch of a given account id, 1 when no block was expected",
+			[]string{"epoch"},
+			nil,
+		),
+		chunkProductivityDesc: prometheus.NewDesc(
+			"near_account_chunk_productivity_ratio",
+			"Ratio of produced to expected chunks in epoch of a given account id, 1 when no chunk was expected",
+			[]string{"epoch"},
+			nil,
+		),
+		uptimeDesc: prometheus.NewDesc(
+			"near_account_uptime_ratio",
+			"Average of the block and chunk productivity ratios in epoch of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		currentCountDesc: prometheus.NewDesc(
+			"near_validators_current_count",
+			"The number of current validators",
+			[]string{"epoch"},
+			nil,
+		),
+		nextCountDesc: prometheus.NewDesc(
+			"near_validators_next_count",
+			"The number of validators of the next epoch",
+			[]string{"epoch"},
+			nil,
+		),
+		rankDesc: prometheus.NewDesc(
+			"near_account_validator_rank",
+			"Position of a given account id among current validators by stake, starting at 1",
+			[]string{"epoch"},
+			nil,
+		),
+		isCurrentDesc: prometheus.NewDesc(
+			"near_account_is_current_validator",
+			"Whether a given account id is a validator in the current epoch",
+			nil,
+			nil,
+		),
+		isNextDesc: prometheus.NewDesc(
+			"near_account_is_next_validator",
+			"Whether a given account id is a validator in the next epoch",
+			nil,
+			nil,
+		),
+		hasProposalDesc: prometheus.NewDesc(
+			"near_account_has_proposal",
+			"Whether a given account id has a stake proposal in the current epoch",
+			nil,
+			nil,
+		),
+		kickoutRiskDesc: prometheus.NewDesc(
+			"near_account_kickout_risk",
+			"Distance of the lower productivity ratio of a given account id to its kickout threshold, negative below the threshold",
+			[]string{"epoch"},
+			nil,
+		),
+		delegatorStakeDesc: prometheus.NewDesc(
+			"near_account_delegator_stake",
+			"Delegators stake of a given account id",
+			[]string{"delegator_account_id", "epoch"},
+			nil,
+		),
+		currentValidatorStakeDesc: prometheus.NewDesc(
+			"near_account_current_validator_stake",
+			"Current amount of validator stake of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		nextValidatorStakeDesc: prometheus.NewDesc(
+			"near_account_next_validator_stake",
+			"The next validator stake of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		currentProposalsDesc: prometheus.NewDesc(
+			"near_account_current_proposals_stake",
+			"Current proposals of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		currentStakeYoctoDesc:   yoctoDesc("near_account_current_validator_stake", "Current amount of validator stake of a given account id", []string{"epoch"}),
+		nextStakeYoctoDesc:      yoctoDesc("near_account_next_validator_stake", "The next validator stake of a given account id", []string{"epoch"}),
+		proposalsStakeYoctoDesc: yoctoDesc("near_account_current_proposals_stake", "Current proposals of a given account id", []string{"epoch"}),
+		prevEpochKickoutDesc: prometheus.NewDesc(
+			"near_account_prev_epoch_kickout",
+			"Whether a given account id was kicked out in the previous epoch, by reason",
+			[]string{"reason", "epoch"},
+			nil,
+		),
+		kickoutProducedDesc: prometheus.NewDesc(
+			"near_account_prev_epoch_kickout_produced",
+			"The number of blocks or chunks produced by a given account id kicked out in the previous epoch for not producing enough",
+			[]string{"reason", "epoch"},
+			nil,
+		),
+		kickoutExpectedDesc: prometheus.NewDesc(
+			"near_account_prev_epoch_kickout_expected",
+			"The number of blocks or chunks expected from a given account id kicked out in the previous epoch for not producing enough",
+			[]string{"reason", "epoch"},
+			nil,
+		),
+		kickoutStakeDesc: prometheus.NewDesc(
+			"near_account_prev_epoch_kickout_stake",
+			"The stake of a given account id kicked out in the previous epoch for not having enough stake",
+			[]string{"epoch"},
+			nil,
+		),
+		kickoutThresholdDesc: prometheus.NewDesc(
+			"near_account_prev_epoch_kickout_stake_threshold",
+			"The stake required for a seat when a given account id was kicked out for not having enough stake",
+			[]string{"epoch"},
+			nil,
+		),
+		kickoutsDesc: prometheus.NewDesc(
+			"near_account_kickouts_total",
+			"The number of kickouts of a given account id seen since the exporter started, by reason",
+			[]string{"reason"},
+			nil,
+		),
+		epochStartHeightDesc: prometheus.NewDesc(
+			"near_epoch_start_height",
+			"Near epoch start height",
+			[]string{"epoch"},
+			nil,
+		),
+		seatPriceDesc: prometheus.NewDesc(
+			"near_seat_price",
+			"Validator seat price",
+			[]string{"epoch"},
+			nil,
+		),
+		nextSeatPriceDesc: prometheus.NewDesc(
+			"near_next_seat_price",
+			"Validator seat price of the next epoch",
+			[]string{"epoch"},
+			nil,
+		),
+		proposalsSeatPriceDesc: prometheus.NewDesc(
+			"near_proposals_seat_price",
+			"Projected validator seat price of the epoch after next from the current proposals",
+			[]string{"epoch"},
+			nil,
+		),
+		proposalStakeDesc: prometheus.NewDesc(
+			"near_current_proposals_stake",
+			"Current proposals stake of all accounts",
+			[]string{"account_id", "epoch"},
+			nil,
+		),
+		pendingWithdrawalDesc: prometheus.NewDesc(
+			"near_account_pending_withdrawal_balance",
+			"Unstaked balance of the delegators of a given account id which can not be withdrawn yet",
+			[]string{"epoch"},
+			nil,
+		),
+		pendingDelegatorsDesc: prometheus.NewDesc(
+			"near_account_pending_withdrawal_delegators",
+			"The number of delegators of a given account id waiting for their unstaked balance to become withdrawable",
+			[]string{"epoch"},
+			nil,
+		),
+		withdrawalEpochDesc: prometheus.NewDesc(
+			"near_account_delegator_withdrawal_epoch",
+			"Estimated epoch height at which the unstaked balance of a delegator becomes withdrawable",
+			[]string{"delegator_account_id"},
+			nil,
+		),
+		withdrawalHeightDesc: prometheus.NewDesc(
+			"near_account_delegator_withdrawal_height",
+			"Estimated block height at which the unstaked balance of a delegator becomes withdrawable",
+			[]string{"delegator_account_id"},
+			nil,
+		),
+		projectedStakeDesc: prometheus.NewDesc(
+			"near_account_projected_next_epoch_stake",
+			"Projected stake of a given account id including its proposal and pending pool deposits and withdrawals",
+			[]string{"epoch"},
+			nil,
+		),
+		seatsOccupiedDesc: prometheus.NewDesc(
+			"near_account_seats_occupied",
+			"The number of seats the stake of a given account id covers at the current seat price",
+			[]string{"epoch"},
+			nil,
+		),
+		delegatorsDesc: prometheus.NewDesc(
+			"near_account_delegators_total",
+			"The number of delegators of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		delegatedStakeDesc: prometheus.NewDesc(
+			"near_account_delegated_stake_total",
+			"The sum of delegators stake of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		unstakedBalanceDesc: prometheus.NewDesc(
+			"near_account_unstaked_balance_total",
+			"The sum of delegators unstaked balance of a given account id",
+			[]string{"epoch"},
+			nil,
+		),
+		canWithdrawDesc: prometheus.NewDesc(
+			"near_account_delegator_can_withdraw_count",
+			"The number of delegators of a given account id which can withdraw their unstaked balance",
+			[]string{"epoch"},
+			nil,
+		),
+		depositsDesc: prometheus.NewDesc(
+			"near_account_delegator_deposits_total",
+			"Stake added by delegators of a given account id since the exporter started, rewards excluded",
+			nil,
+			nil,
+		),
+		withdrawalsDesc: prometheus.NewDesc(
+			"near_account_delegator_withdrawals_total",
+			"Stake removed by delegators of a given account id since the exporter started",
+			nil,
+			nil,
+		),
+		stakeChangeDesc: prometheus.NewDesc(
+			"near_account_stake_change",
+			"Net change of the stake delegated to a given account id since the previous scrape, rewards excluded",
+			nil,
+			nil,
+		),
+		blocksProducedTotalDesc: prometheus.NewDesc(
+			"near_account_blocks_produced_total",
+			"The number of blocks produced by a given account id across epochs",
+			nil,
+			nil,
+		),
+		blocksExpectedTotalDesc: prometheus.NewDesc(
+			"near_account_blocks_expected_total",
+			"The number of blocks expected from a given account id across epochs",
+			nil,
+			nil,
+		),
+		chunksProducedTotalDesc: prometheus.NewDesc(
+			"near_account_chunks_produced_total",
+			"The number of chunks produced by a given account id across epochs",
+			nil,
+			nil,
+		),
+		chunksExpectedTotalDesc: prometheus.NewDesc(
+			"near_account_chunks_expected_total",
+			"The number of chunks expected from a given account id across epochs",
+			nil,
+			nil,
+		),
+		whitelistedDesc: prometheus.NewDesc(
+			"near_account_pool_whitelisted",
+			"Whether the staking pool of a given account id is whitelisted for lockup delegations",
+			nil,
+			nil,
+		),
+		epochHeightDesc: prometheus.NewDesc(
+			"near_epoch_height_total",
+			"Near epoch height, with the epoch start height as exemplar",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (collector *ValidatorMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.epochBlockProducedDesc
+	ch <- collector.epochBlockExpectedDesc
+	ch <- collector.epochChunksProducedDesc
+	ch <- collector.epochChunksExpectedDesc
+	ch <- collector.blocksProducedTotalDesc
+	ch <- collector.blocksExpectedTotalDesc
+	ch <- collector.chunksProducedTotalDesc
+	ch <- collector.chunksExpectedTotalDesc
+	ch <- collector.blockProductivityDesc
+	ch <- collector.chunkProductivityDesc
+	ch <- collector.uptimeDesc
+	ch <- collector.kickoutRiskDesc
+	ch <- collector.seatPriceDesc
+	ch <- collector.nextSeatPriceDesc
+	ch <- collector.proposalsSeatPriceDesc
+	ch <- collector.currentCountDesc
+	ch <- collector.nextCountDesc
+	ch <- collector.rankDesc
+	ch <- collector.isCurrentDesc
+	ch <- collector.isNextDesc
+	ch <- collector.hasProposalDesc
+	ch <- collector.delegatorStakeDesc
+	ch <- collector.epochStartHeightDesc
+	ch <- collector.currentValidatorStakeDesc
+	ch <- collector.nextValidatorStakeDesc
+	ch <- collector.currentProposalsDesc
+	if collector.settings.RawYocto {
+		ch <- collector.currentStakeYoctoDesc
+		ch <- collector.nextStakeYoctoDesc
+		ch <- collector.proposalsStakeYoctoDesc
+	}
+	ch <- collector.seatsOccupiedDesc
+	ch <- collector.projectedStakeDesc
+	ch <- collector.pendingWithdrawalDesc
+	ch <- collector.pendingDelegatorsDesc
+	ch <- collector.delegatorsDesc
+	ch <- collector.delegatedStakeDesc
+	ch <- collector.unstakedBalanceDesc
+	ch <- collector.canWithdrawDesc
+	ch <- collector.depositsDesc
+	ch <- collector.withdrawalsDesc
+	ch <- collector.stakeChangeDesc
+	ch <- collector.withdrawalEpochDesc
+	ch <- collector.withdrawalHeightDesc
+	if collector.allProposals {
+		ch <- collector.proposalStakeDesc
+	}
+	ch <- collector.prevEpochKickoutDesc
+	ch <- collector.kickoutProducedDesc
+	ch <- collector.kickoutExpectedDesc
+	ch <- collector.kickoutStakeDesc
+	ch <- collector.kickoutThresholdDesc
+	ch <- collector.kickoutsDesc
+	ch <- collector.whitelistedDesc
+	if collector.exemplars {
+		ch <- collector.epochHeightDesc
+	}
+}
+
+func (collector *ValidatorMetrics) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(context.Background(), ch)
+}
+
+func (collector *ValidatorMetrics) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var validatorsParams interface{} = "latest"
+	if collector.blockId != "" {
+		validatorsParams = []interface{}{BlockId(collector.blockId)}
+	}
+	r, err := collector.client.GetContext(ctx, "validators", validatorsParams)
+	if err != nil {
+		// Every metric depends on the validators, so all of them fail.
+		invalidMetrics(collector, ch, err)
+		return
+	}
+
+	epoch := r.Validators.EpochHeight
+	ch <- prometheus.MustNewConstMetric(collector.epochStartHeightDesc, prometheus.GaugeValue, float64(r.Validators.EpochStartHeight), fmt.Sprintf("%d", epoch))
+	if collector.exemplars {
+		ch <- mustNewCounterWithExemplar(collector.epochHeightDesc, float64(epoch), prometheus.Labels{
+			"block_height": fmt.Sprintf("%d", r.Validators.EpochStartHeight),
+		})
+	}
+
+	pc, pcErr := collector.client.GetContext(ctx, "EXPERIMENTAL_protocol_config", withBlockRef(map[string]interface{}{}, collector.blockId))
+
+	var seatPrice, accountStake float64
+	isCurrentValidator := false
+	for _, v := range r.Validators.CurrentValidators {
+		stake := collector.settings.amount(v.Stake)
+		if seatPrice == 0 {
+			seatPrice = stake
+		}
+		if seatPrice > stake {
+			seatPrice = stake
+		}
+		if v.AccountId == collector.accountId {
+			accountStake = stake
+			isCurrentValidator = true
+			ch <- prometheus.MustNewConstMetric(collector.currentValidatorStakeDesc, prometheus.GaugeValue, stake, fmt.Sprintf("%d", epoch))
+			if collector.settings.RawYocto {
+				ch <- mustNewYoctoMetric(collector.currentStakeYoctoDesc, v.Stake, fmt.Sprintf("%d", epoch))
+			}
+			ch <- prometheus.MustNewConstMetric(collector.epochBlockProducedDesc, prometheus.GaugeValue, float64(v.NumProducedBlocks), fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.epochBlockExpectedDesc, prometheus.GaugeValue, float64(v.NumExpectedBlocks), fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.epochChunksProducedDesc, prometheus.GaugeValue, float64(v.NumProducedChunks), fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.epochChunksExpectedDesc, prometheus.GaugeValue, float64(v.NumExpectedChunks), fmt.Sprintf("%d", epoch))
+			total := collector.production.update(collector.accountId, epoch, v)
+			ch <- prometheus.MustNewConstMetric(collector.blocksProducedTotalDesc, prometheus.CounterValue, float64(total.BlocksProduced))
+			ch <- prometheus.MustNewConstMetric(collector.blocksExpectedTotalDesc, prometheus.CounterValue, float64(total.BlocksExpected))
+			ch <- prometheus.MustNewConstMetric(collector.chunksProducedTotalDesc, prometheus.CounterValue, float64(total.ChunksProduced))
+			ch <- prometheus.MustNewConstMetric(collector.chunksExpectedTotalDesc, prometheus.CounterValue, float64(total.ChunksExpected))
+			ch <- prometheus.MustNewConstMetric(collector.blockProductivityDesc, prometheus.GaugeValue, productivityRatio(v.NumProducedBlocks, v.NumExpectedBlocks), fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.chunkProductivityDesc, prometheus.GaugeValue, productivityRatio(v.NumProducedChunks, v.NumExpectedChunks), fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.uptimeDesc, prometheus.GaugeValue, uptimeRatio(v), fmt.Sprintf("%d", epoch))
+			if pcErr != nil {
+				ch <- prometheus.NewInvalidMetric(collector.kickoutRiskDesc, pcErr)
+			} else {
+				margin := kickoutMargin(v, pc.ProtocolConfig.BlockProducerKickoutThreshold, pc.ProtocolConfig.ChunkProducerKickoutThreshold)
+				ch <- prometheus.MustNewConstMetric(collector.kickoutRiskDesc, prometheus.GaugeValue, margin, fmt.Sprintf("%d", epoch))
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.seatPriceDesc, prometheus.GaugeValue, seatPrice, fmt.Sprintf("%d", epoch))
+
+	var nextSeatPrice float64
+	for _, v := range r.Validators.NextValidators {
+		stake := collector.settings.amount(v.Stake)
+		if nextSeatPrice == 0 || nextSeatPrice > stake {
+			nextSeatPrice = stake
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.nextSeatPriceDesc, prometheus.GaugeValue, nextSeatPrice, fmt.Sprintf("%d", epoch))
+	if pcErr != nil {
+		ch <- prometheus.NewInvalidMetric(collector.proposalsSeatPriceDesc, pcErr)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.proposalsSeatPriceDesc, prometheus.GaugeValue, proposalsSeatPrice(r, pc.ProtocolConfig.NumBlockProducerSeats, collector.settings.Unit), fmt.Sprintf("%d", epoch))
+	}
+	if isCurrentValidator && seatPrice > 0 {
+		ch <- prometheus.MustNewConstMetric(collector.seatsOccupiedDesc, prometheus.GaugeValue, math.Floor(accountStake/seatPrice), fmt.Sprintf("%d", epoch))
+	}
+	ch <- prometheus.MustNewConstMetric(collector.currentCountDesc, prometheus.GaugeValue, float64(len(r.Validators.CurrentValidators)), fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.nextCountDesc, prometheus.GaugeValue, float64(len(r.Validators.NextValidators)), fmt.Sprintf("%d", epoch))
+	if isCurrentValidator {
+		rank := 1
+		for _, v := range r.Validators.CurrentValidators {
+			if collector.settings.amount(v.Stake) > accountStake {
+				rank++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(collector.rankDesc, prometheus.GaugeValue, float64(rank), fmt.Sprintf("%d", epoch))
+	}
+	isNextValidator := false
+	for _, v := range r.Validators.NextValidators {
+		if v.AccountId == collector.accountId {
+			isNextValidator = true
+		}
+	}
+	_, hasProposal := findProposal(r, collector.accountId)
+	ch <- prometheus.MustNewConstMetric(collector.isCurrentDesc, prometheus.GaugeValue, boolToFloat(isCurrentValidator))
+	ch <- prometheus.MustNewConstMetric(collector.isNextDesc, prometheus.GaugeValue, boolToFloat(isNextValidator))
+	ch <- prometheus.MustNewConstMetric(collector.hasProposalDesc, prometheus.GaugeValue, boolToFloat(hasProposal))
+
+	projectedStake, hasProjection := accountStake, isCurrentValidator
+	for _, v := range r.Validators.NextValidators {
+		if v.AccountId == collector.accountId {
+			projectedStake, hasProjection = collector.settings.amount(v.Stake), true
+			ch <- prometheus.MustNewConstMetric(collector.nextValidatorStakeDesc, prometheus.GaugeValue, collector.settings.amount(v.Stake), fmt.Sprintf("%d", epoch))
+			if collector.settings.RawYocto {
+				ch <- mustNewYoctoMetric(collector.nextStakeYoctoDesc, v.Stake, fmt.Sprintf("%d", epoch))
+			}
+		}
+	}
+
+	for _, v := range r.Validators.CurrentProposals {
+		if collector.allProposals {
+			ch <- prometheus.MustNewConstMetric(collector.proposalStakeDesc, prometheus.GaugeValue, collector.settings.amount(v.Stake), v.AccountId, fmt.Sprintf("%d", epoch))
+		}
+		if v.AccountId == collector.accountId {
+			ch <- prometheus.MustNewConstMetric(collector.currentProposalsDesc, prometheus.GaugeValue, collector.settings.amount(v.Stake), fmt.Sprintf("%d", epoch))
+			if collector.settings.RawYocto {
+				ch <- mustNewYoctoMetric(collector.proposalsStakeYoctoDesc, v.Stake, fmt.Sprintf("%d", epoch))
+			}
+		}
+	}
+
+	// A proposal replaces the stake of the account. Without one, the total
+	// staked balance of the pool contract includes deposits and withdrawals
+	// which will be proposed on the next ping.
+	if proposal, ok := findProposal(r, collector.accountId); ok {
+		projectedStake, hasProjection = collector.settings.amount(proposal.Stake), true
+	} else {
+		var totalStaked string
+		if err := callFunction(ctx, collector.client, collector.accountId, "get_total_staked_balance", map[string]string{}, collector.blockId, &totalStaked); err == nil {
+			projectedStake, hasProjection = collector.settings.amount(totalStaked), true
+		}
+	}
+	if hasProjection {
+		ch <- prometheus.MustNewConstMetric(collector.projectedStakeDesc, prometheus.GaugeValue, projectedStake, fmt.Sprintf("%d", epoch))
+	}
+
+	collector.mu.Lock()
+	for _, v := range r.Validators.PrevEpochKickOut {
+		if v.AccountId != collector.accountId {
+			continue
+		}
+		reason := v.Reason
+		ch <- prometheus.MustNewConstMetric(collector.prevEpochKickoutDesc, prometheus.GaugeValue, 1, reason.Name, fmt.Sprintf("%d", epoch))
+		switch reason.Name {
+		case "NotEnoughStake":
+			ch <- prometheus.MustNewConstMetric(collector.kickoutStakeDesc, prometheus.GaugeValue, collector.settings.amount(reason.Stake), fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.kickoutThresholdDesc, prometheus.GaugeValue, collector.settings.amount(reason.Threshold), fmt.Sprintf("%d", epoch))
+		case "NotEnoughBlocks", "NotEnoughChunks", "NotEnoughChunkEndorsements":
+			ch <- prometheus.MustNewConstMetric(collector.kickoutProducedDesc, prometheus.GaugeValue, float64(reason.Produced), reason.Name, fmt.Sprintf("%d", epoch))
+			ch <- prometheus.MustNewConstMetric(collector.kickoutExpectedDesc, prometheus.GaugeValue, float64(reason.Expected), reason.Name, fmt.Sprintf("%d", epoch))
+		}
+		if epoch > collector.lastKickoutEpoch {
+			collector.kickouts[reason.Name]++
+		}
+	}
+	if epoch > collector.lastKickoutEpoch {
+		collector.lastKickoutEpoch = epoch
+	}
+	for reason, n := range collector.kickouts {
+		ch <- prometheus.MustNewConstMetric(collector.kickoutsDesc, prometheus.CounterValue, n, reason)
+	}
+	collector.mu.Unlock()
+
+	// Networks without lockups, e.g. localnet, have no whitelist contract.
+	if collector.settings.WhitelistAccountId != "" {
+		var whitelisted bool
+		err = callFunction(ctx, collector.client, collector.settings.WhitelistAccountId, "is_whitelisted", map[string]string{"staking_pool_account_id": collector.accountId}, collector.blockId, &whitelisted)
+		if err != nil && !isUnknownAccount(err) {
+			ch <- prometheus.NewInvalidMetric(collector.whitelistedDesc, err)
+		} else if err == nil {
+			ch <- prometheus.MustNewConstMetric(collector.whitelistedDesc, prometheus.GaugeValue, boolToFloat(whitelisted))
+		}
+	}
+
+	res, err := getAllAccounts(ctx, collector.client, collector.accountId, collector.blockId, collector.settings)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collector.delegatorStakeDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.pendingWithdrawalDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.pendingDelegatorsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.delegatorsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.delegatedStakeDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.unstakedBalanceDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.canWithdrawDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.depositsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.withdrawalsDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.stakeChangeDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.withdrawalEpochDesc, err)
+		ch <- prometheus.NewInvalidMetric(collector.withdrawalHeightDesc, err)
+		return
+	}
+
+	var pendingBalance, delegatedStake, unstakedBalance float64
+	pendingDelegators, canWithdraw := 0, 0
+	for _, delegator := range res {
+		staked := collector.settings.amount(delegator.StakedBalance)
+		ch <- prometheus.MustNewConstMetric(collector.delegatorStakeDesc, prometheus.GaugeValue, staked, delegator.AccountId, fmt.Sprintf("%d", epoch))
+		delegatedStake += staked
+		unstaked := collector.settings.amount(delegator.UnstakedBalance)
+		unstakedBalance += unstaked
+		if unstaked > 0 && !delegator.CanWithdraw {
+			pendingBalance += unstaked
+			pendingDelegators++
+		}
+		if unstaked > 0 && delegator.CanWithdraw {
+			canWithdraw++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.delegatorsDesc, prometheus.GaugeValue, float64(len(res)), fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.delegatedStakeDesc, prometheus.GaugeValue, delegatedStake, fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.unstakedBalanceDesc, prometheus.GaugeValue, unstakedBalance, fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.canWithdrawDesc, prometheus.GaugeValue, float64(canWithdraw), fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.pendingWithdrawalDesc, prometheus.GaugeValue, pendingBalance, fmt.Sprintf("%d", epoch))
+	ch <- prometheus.MustNewConstMetric(collector.pendingDelegatorsDesc, prometheus.GaugeValue, float64(pendingDelegators), fmt.Sprintf("%d", epoch))
+
+	collector.collectStakeChanges(ch, res)
+	collector.collectWithdrawalEstimates(ctx, ch, res, epoch, r.Validators.EpochStartHeight)
+}
+
+// collectStakeChanges compares the staked balances of the delegators with
+// the previous scrape. Rewards raise all balances by the same factor, which
+// is estimated as the median ratio of the balances, as most delegators don't
+// change their stake between two scrapes. Delegators who left the pool
+// withdrew their whole stake.
+func (collector *ValidatorMetrics) collectStakeChanges(ch chan<- prometheus.Metric, delegators []DelegatorAccount) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	stakes := make(map[string]float64, len(delegators))
+	for _, delegator := range delegators {
+		stakes[delegator.AccountId] = collector.settings.amount(delegator.StakedBalance)
+	}
+	prev := collector.delegatorStakes
+	collector.delegatorStakes = stakes
+
+	var ratios []float64
+	for accountId, stake := range stakes {
+		if old := prev[accountId]; old > 0 && stake > 0 {
+			ratios = append(ratios, stake/old)
+		}
+	}
+	rewardFactor := 1.0
+	if len(ratios) > 0 {
+		sort.Float64s(ratios)
+		rewardFactor = ratios[len(ratios)/2]
+	}
+
+	var change float64
+	if prev != nil {
+		for accountId, stake := range stakes {
+			delta := stake - prev[accountId]*rewardFactor
+			if delta > 0 {
+				collector.deposits += delta
+			} else {
+				collector.withdrawals -= delta
+			}
+			change += delta
+		}
+		for accountId, old := range prev {
+			if _, ok := stakes[accountId]; !ok {
+				collector.withdrawals += old
+				change -= old
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.depositsDesc, prometheus.CounterValue, collector.deposits)
+	ch <- prometheus.MustNewConstMetric(collector.withdrawalsDesc, prometheus.CounterValue, collector.withdrawals)
+	ch <- prometheus.MustNewConstMetric(collector.stakeChangeDesc, prometheus.GaugeValue, change)
+}
+
+// collectWithdrawalEstimates estimates when pending unstakes become
+// withdrawable. get_accounts doesn't return the unlock epoch, so it is
+// derived from the epoch in which an increase of the unstaked balance was
+// first seen. Unstakes which happened before the exporter started are assumed
+// to have happened in the current epoch.
+func (collector *ValidatorMetrics) collectWithdrawalEstimates(ctx context.Context, ch chan<- prometheus.Metric, delegators []DelegatorAccount, epoch int64, epochStartHeight int64) {
+	var epochLength int64
+	if r, err := collector.client.GetContext(ctx, "EXPERIMENTAL_protocol_config", withBlockRef(map[string]interface{}{}, collector.blockId)); err == nil {
+		epochLength = r.ProtocolConfig.EpochLength
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, delegator := range delegators {
+		unstaked := collector.settings.amount(delegator.UnstakedBalance)
+		if unstaked == 0 || delegator.CanWithdraw {
+			continue
+		}
+		seen[delegator.AccountId] = true
+		p, ok := collector.pendingUnstake[delegator.AccountId]
+		if !ok {
+			p = &pendingUnstake{epoch: epoch}
+			collector.pendingUnstake[delegator.AccountId] = p
+		} else if unstaked > p.unstaked {
+			p.epoch = epoch
+		}
+		p.unstaked = unstaked
+
+		availableEpoch := p.epoch + numEpochsToUnlock
+		ch <- prometheus.MustNewConstMetric(collector.withdrawalEpochDesc, prometheus.GaugeValue, float64(availableEpoch), delegator.AccountId)
+		if epochLength > 0 {
+			height := epochStartHeight + (availableEpoch-epoch)*epochLength
+			ch <- prometheus.MustNewConstMetric(collector.withdrawalHeightDesc, prometheus.GaugeValue, float64(height), delegator.AccountId)
+		}
+	}
+	for accountId := range collector.pendingUnstake {
+		if !seen[accountId] {
+			delete(collector.pendingUnstake, accountId)
+		}
+	}
+}
+
+func findProposal(r *nearapi.Result, accountId string) (nearapi.Validator, bool) {
+	for _, v := range r.Validators.CurrentProposals {
+		if v.AccountId == accountId {
+			return v.Validator, true
+		}
+	}
+	return nearapi.Validator{}, false
+}
+
+// proposalsSeatPrice projects the seat price of the epoch after next: the
+// proposals replace the stakes of the next validators, which otherwise roll
+// over, and the given number of seats go to the highest stakes. It is
+// returned in unit.
+func proposalsSeatPrice(r *nearapi.Result, seats int64, unit Unit) float64 {
+	stakes := make(map[string]float64)
+	for _, v := range r.Validators.NextValidators {
+		stakes[v.AccountId] = GetStakeFromString(v.Stake, unit)
+	}
+	for _, v := range r.Validators.CurrentProposals {
+		stakes[v.AccountId] = GetStakeFromString(v.Stake, unit)
+	}
+	var sorted []float64
+	for _, stake := range stakes {
+		if stake > 0 {
+			sorted = append(sorted, stake)
+		}
+	}
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	if seats > 0 && int64(len(sorted)) > seats {
+		sorted = sorted[:seats]
+	}
+	return sorted[len(sorted)-1]
+}
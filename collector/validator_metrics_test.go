@@ -0,0 +1,302 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newTestValidatorMetrics(t *testing.T, url string, accountId string, settings Settings) *ValidatorMetrics {
+	production, err := NewProductionState("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewValidatorMetrics(nearapi.NewClient(url), accountId, "", false, false, production, settings)
+}
+
+func TestValidatorMetricsCollect(t *testing.T) {
+	failView := func(accountId string, method string) func(n *rpctest.Node) {
+		return func(n *rpctest.Node) {
+			n.HandleView(accountId, method, func(json.RawMessage) (interface{}, error) { return nil, errors.New("contract panicked") })
+		}
+	}
+	tests := []struct {
+		name     string
+		setup    func(n *rpctest.Node)
+		settings Settings
+		metrics  []string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "validator",
+			settings: Settings{WhitelistAccountId: rpctest.WhitelistId},
+			metrics: []string{"near_account_epoch_block_produced_number", "near_account_is_current_validator", "near_account_validator_rank",
+				"near_seat_price", "near_account_delegators_total", "near_account_delegator_stake", "near_account_pool_whitelisted"},
+			want: `
+# HELP near_account_epoch_block_produced_number The number of block produced in epoch of a given account id
+# TYPE near_account_epoch_block_produced_number gauge
+near_account_epoch_block_produced_number{epoch="100"} 95
+# HELP near_account_is_current_validator Whether a given account id is a validator in the current epoch
+# TYPE near_account_is_current_validator gauge
+near_account_is_current_validator 1
+# HELP near_account_validator_rank Position of a given account id among current validators by stake, starting at 1
+# TYPE near_account_validator_rank gauge
+near_account_validator_rank{epoch="100"} 2
+# HELP near_seat_price Validator seat price
+# TYPE near_seat_price gauge
+near_seat_price{epoch="100"} 6000
+# HELP near_account_delegators_total The number of delegators of a given account id
+# TYPE near_account_delegators_total gauge
+near_account_delegators_total{epoch="100"} 3
+# HELP near_account_delegator_stake Delegators stake of a given account id
+# TYPE near_account_delegator_stake gauge
+near_account_delegator_stake{delegator_account_id="alice.test",epoch="100"} 1000
+near_account_delegator_stake{delegator_account_id="bob.test",epoch="100"} 2000
+near_account_delegator_stake{delegator_account_id="carol.test",epoch="100"} 3000
+# HELP near_account_pool_whitelisted Whether the staking pool of a given account id is whitelisted for lockup delegations
+# TYPE near_account_pool_whitelisted gauge
+near_account_pool_whitelisted 1
+`,
+		},
+		{
+			name:     "millinear",
+			settings: Settings{Unit: MilliNear},
+			metrics:  []string{"near_account_current_validator_stake", "near_account_pool_whitelisted"},
+			want: `
+# HELP near_account_current_validator_stake Current amount of validator stake of a given account id
+# TYPE near_account_current_validator_stake gauge
+near_account_current_validator_stake{epoch="100"} 6000000
+`,
+		},
+		{
+			name:     "no whitelist contract",
+			settings: Settings{WhitelistAccountId: "whitelist.testnet"},
+			metrics:  []string{"near_account_pool_whitelisted"},
+		},
+		{
+			name:    "validators HTTP error",
+			setup:   func(n *rpctest.Node) { n.Fail("validators", http.StatusServiceUnavailable) },
+			wantErr: "validators: 503 Service Unavailable",
+		},
+		{
+			name: "validators JSON-RPC error",
+			setup: func(n *rpctest.Node) {
+				n.Handle("validators", func(json.RawMessage) (interface{}, error) { return nil, errors.New("epoch out of bounds") })
+			},
+			wantErr: "Server error: epoch out of bounds",
+		},
+		{
+			name:    "malformed validators",
+			setup:   func(n *rpctest.Node) { n.SetResult("validators", []int{1, 2}) },
+			wantErr: "cannot unmarshal array",
+		},
+		{
+			name:     "whitelist error",
+			setup:    failView(rpctest.WhitelistId, "is_whitelisted"),
+			settings: Settings{WhitelistAccountId: rpctest.WhitelistId},
+			wantErr:  "Server error: contract panicked",
+		},
+		{
+			name:    "get_accounts error",
+			setup:   failView(rpctest.ValidatorId, "get_accounts"),
+			wantErr: "Server error: contract panicked",
+		},
+		{
+			name:    "malformed get_accounts",
+			setup:   func(n *rpctest.Node) { n.SetView(rpctest.ValidatorId, "get_accounts", "garbage") },
+			wantErr: "cannot unmarshal string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := rpctest.NewNode()
+			if tt.setup != nil {
+				tt.setup(n)
+			}
+			srv := rpctest.NewServer(n)
+			defer srv.Close()
+
+			c := newTestValidatorMetrics(t, srv.URL, rpctest.ValidatorId, tt.settings)
+			err := testutil.CollectAndCompare(c, strings.NewReader(tt.want), tt.metrics...)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatorMetricsAccounts(t *testing.T) {
+	n := rpctest.NewNode()
+	n.SetView(rpctest.OtherValidatorId, "get_accounts", []rpctest.Delegator{})
+	srv := rpctest.NewServer(n)
+	defer srv.Close()
+
+	r := prometheus.NewPedanticRegistry()
+	for _, id := range []string{rpctest.ValidatorId, rpctest.OtherValidatorId} {
+		c := newTestValidatorMetrics(t, srv.URL, id, Settings{})
+		prometheus.WrapRegistererWith(prometheus.Labels{"account_id": id}, r).MustRegister(c)
+	}
+	want := `
+# HELP near_account_current_validator_stake Current amount of validator stake of a given account id
+# TYPE near_account_current_validator_stake gauge
+near_account_current_validator_stake{account_id="other.test",epoch="100"} 14000
+near_account_current_validator_stake{account_id="validator.test",epoch="100"} 6000
+# HELP near_account_delegators_total The number of delegators of a given account id
+# TYPE near_account_delegators_total gauge
+near_account_delegators_total{account_id="other.test",epoch="100"} 0
+near_account_delegators_total{account_id="validator.test",epoch="100"} 3
+# HELP near_account_validator_rank Position of a given account id among current validators by stake, starting at 1
+# TYPE near_account_validator_rank gauge
+near_account_validator_rank{account_id="other.test",epoch="100"} 1
+near_account_validator_rank{account_id="validator.test",epoch="100"} 2
+`
+	err := testutil.GatherAndCompare(r, strings.NewReader(want),
+		"near_account_current_validator_stake", "near_account_delegators_total", "near_account_validator_rank")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidatorMetricsValidatorsError(t *testing.T) {
+	n := rpctest.NewNode()
+	n.Fail("validators", http.StatusBadGateway)
+	srv := rpctest.NewServer(n)
+	defer srv.Close()
+	production, err := NewProductionState("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewValidatorMetrics(nearapi.NewClient(srv.URL), rpctest.ValidatorId, "", true, true, production, Settings{RawYocto: true})
+
+	descs := make(chan *prometheus.Desc, 100)
+	c.Describe(descs)
+	close(descs)
+	want := make(map[string]bool)
+	for d := range descs {
+		want[d.String()] = true
+	}
+	metrics := make(chan prometheus.Metric, 100)
+	c.Collect(metrics)
+	close(metrics)
+	for m := range metrics {
+		if m.Write(&dto.Metric{}) == nil {
+			t.Errorf("got a valid metric %s", m.Desc())
+		}
+		delete(want, m.Desc().String())
+	}
+	for d := range want {
+		t.Errorf("no invalid metric for %s", d)
+	}
+}
+
+// stakes are the staked balances of delegators by account id, in yoctoNEAR.
+type stakes map[string]string
+
+func TestCollectStakeChanges(t *testing.T) {
+	tests := []struct {
+		name                              string
+		scrapes                           []stakes
+		deposits, withdrawals, lastChange float64
+	}{
+		{
+			name:    "first scrape",
+			scrapes: []stakes{{"alice": "1000", "bob": "2000"}},
+		},
+		{
+			name:    "unchanged",
+			scrapes: []stakes{{"alice": "1000", "bob": "2000"}, {"alice": "1000", "bob": "2000"}},
+		},
+		{
+			name:       "deposit",
+			scrapes:    []stakes{{"alice": "1000", "bob": "2000", "carol": "3000"}, {"alice": "1500", "bob": "2000", "carol": "3000"}},
+			deposits:   500,
+			lastChange: 500,
+		},
+		{
+			name:       "new delegator",
+			scrapes:    []stakes{{"alice": "1000"}, {"alice": "1000", "bob": "700"}},
+			deposits:   700,
+			lastChange: 700,
+		},
+		{
+			name:        "withdrawal",
+			scrapes:     []stakes{{"alice": "1000", "bob": "2000", "carol": "3000"}, {"alice": "1000", "bob": "1500", "carol": "3000"}},
+			withdrawals: 500,
+			lastChange:  -500,
+		},
+		{
+			name:        "delegator left",
+			scrapes:     []stakes{{"alice": "1000", "bob": "2000", "carol": "3000"}, {"alice": "1000", "bob": "2000"}},
+			withdrawals: 3000,
+			lastChange:  -3000,
+		},
+		{
+			name:    "reward only",
+			scrapes: []stakes{{"alice": "1000", "bob": "2000", "carol": "3000"}, {"alice": "1010", "bob": "2020", "carol": "3030"}},
+		},
+		{
+			name:       "reward and deposit",
+			scrapes:    []stakes{{"alice": "1000", "bob": "2000", "carol": "3000"}, {"alice": "1200", "bob": "2200", "carol": "3300"}},
+			deposits:   100,
+			lastChange: 100,
+		},
+		{
+			name: "deposit then withdrawal",
+			scrapes: []stakes{
+				{"alice": "1000", "bob": "2000", "carol": "3000"},
+				{"alice": "1400", "bob": "2000", "carol": "3000"},
+				{"alice": "1400", "bob": "1800", "carol": "3000"},
+			},
+			deposits:    400,
+			withdrawals: 200,
+			lastChange:  -200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewValidatorMetrics(nil, rpctest.ValidatorId, "", false, false, nil, Settings{Unit: YoctoNear})
+			var deposits, withdrawals, change float64
+			for _, scrape := range tt.scrapes {
+				var delegators []DelegatorAccount
+				for id, staked := range scrape {
+					delegators = append(delegators, DelegatorAccount{AccountId: id, StakedBalance: staked, UnstakedBalance: "0"})
+				}
+				ch := make(chan prometheus.Metric, 3)
+				c.collectStakeChanges(ch, delegators)
+				deposits, withdrawals, change = metricValue(t, <-ch), metricValue(t, <-ch), metricValue(t, <-ch)
+			}
+			for _, v := range []struct {
+				name      string
+				got, want float64
+			}{{"deposits", deposits, tt.deposits}, {"withdrawals", withdrawals, tt.withdrawals}, {"change", change, tt.lastChange}} {
+				if math.Abs(v.got-v.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", v.name, v.got, v.want)
+				}
+			}
+		})
+	}
+}
+
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	var d dto.Metric
+	if err := m.Write(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Counter != nil {
+		return d.Counter.GetValue()
+	}
+	return d.Gauge.GetValue()
+}
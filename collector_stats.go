@@ -0,0 +1,104 @@
+package main
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// collectorStats exports the health of the exporter itself: whether the last
+// collection of every collector completed without invalid metrics and how
+// long it took.
+type collectorStats struct {
+	buildInfo *prometheus.GaugeVec
+	success   *prometheus.GaugeVec
+	duration  *prometheus.GaugeVec
+	errors    *prometheus.CounterVec
+	timeouts  *prometheus.CounterVec
+}
+
+func newCollectorStats(version string) *collectorStats {
+	s := &collectorStats{
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "near_exporter_build_info",
+			Help: "Version of the exporter, the value is always 1",
+		}, []string{"version", "goversion"}),
+		success: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "near_exporter_collector_success",
+			Help: "Whether the last collection of the collector succeeded",
+		}, []string{"collector"}),
+		duration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "near_exporter_collector_duration_seconds",
+			Help: "Duration of the last collection of the collector",
+		}, []string{"collector"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "near_exporter_collector_errors_total",
+			Help: "The number of collections of the collector which produced invalid metrics",
+		}, []string{"collector"}),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "near_exporter_collector_timeouts_total",
+			Help: "The number of collections of the collector aborted at the scrape deadline",
+		}, []string{"collector"}),
+	}
+	s.buildInfo.WithLabelValues(version, runtime.Version()).Set(1)
+	return s
+}
+
+func (s *collectorStats) Describe(ch chan<- *prometheus.Desc) {
+	s.buildInfo.Describe(ch)
+	s.success.Describe(ch)
+	s.duration.Describe(ch)
+	s.errors.Describe(ch)
+	s.timeouts.Describe(ch)
+}
+
+func (s *collectorStats) Collect(ch chan<- prometheus.Metric) {
+	s.buildInfo.Collect(ch)
+	s.success.Collect(ch)
+	s.duration.Collect(ch)
+	s.errors.Collect(ch)
+	s.timeouts.Collect(ch)
+}
+
+type statsCollector struct {
+	prometheus.Collector
+	stats *collectorStats
+	name  string
+}
+
+func (s *collectorStats) Wrap(name string, c prometheus.Collector) prometheus.Collector {
+	s.errors.WithLabelValues(name)
+	return &statsCollector{Collector: c, stats: s, name: name}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	metrics := make(chan prometheus.Metric)
+	failed := make(chan bool)
+	go func() {
+		invalid := false
+		for m := range metrics {
+			if err := m.Write(&dto.Metric{}); err != nil {
+				if !invalid {
+					logging.Warn("collection failed", "collector", c.name, "err", err)
+				}
+				invalid = true
+			}
+			ch <- m
+		}
+		failed <- invalid
+	}()
+	c.Collector.Collect(metrics)
+	close(metrics)
+
+	c.stats.duration.WithLabelValues(c.name).Set(time.Since(start).Seconds())
+	if <-failed {
+		c.stats.success.WithLabelValues(c.name).Set(0)
+		c.stats.errors.WithLabelValues(c.name).Inc()
+	} else {
+		c.stats.success.WithLabelValues(c.name).Set(1)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var secretFlagWords = []string{"password", "token", "secret", "auth", "apikey", "api-key", "header"}
+
+type effectiveConfig struct {
+	Flags      map[string]string `json:"flags"`
+	Collectors []string          `json:"collectors"`
+}
+
+func isSecretFlag(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretFlagWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL replaces the userinfo and query of an URL, which often carry
+// credentials or provider API keys. Other values are returned unchanged.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.String()
+}
+
+// effectiveFlags returns the flag values, with secrets and the credentials of
+// URLs redacted.
+func effectiveFlags(fs *flag.FlagSet) map[string]string {
+	flags := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; ok {
+			return
+		}
+		value := f.Value.String()
+		if value != "" && isSecretFlag(f.Name) {
+			value = "<redacted>"
+		} else {
+			value = redactURL(value)
+		}
+		flags[f.Name] = value
+	})
+	return flags
+}
+
+// configHandler serves the effective flag values and the names of the
+// registered collectors of the current exporter.
+func configHandler(current func() *exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := current()
+		writeJSON(w, http.StatusOK, effectiveConfig{Flags: e.flags, Collectors: e.collectors})
+	})
+}
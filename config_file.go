@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fileConfig is the YAML config file. Every value sets the flag of the same
+// meaning, flags without a dedicated field can be set by name in the flags
+// section.
+type fileConfig struct {
+	RPC struct {
+		URL               string            `yaml:"url"`
+		ChainURL          string            `yaml:"chain_url"`
+		ReferenceURL      string            `yaml:"reference_url"`
+		Timeout           string            `yaml:"timeout"`
+		Retries           *int              `yaml:"retries"`
+		Backoff           string            `yaml:"backoff"`
+		Headers           map[string]string `yaml:"headers"`
+		BearerToken       string            `yaml:"bearer_token"`
+		BasicAuthUser     string            `yaml:"basic_auth_user"`
+		BasicAuthPassword string            `yaml:"basic_auth_password"`
+	} `yaml:"rpc"`
+	Accounts struct {
+		Validators     []string `yaml:"validators"`
+		Balances       []string `yaml:"balances"`
+		Delegator      string   `yaml:"delegator"`
+		DelegatorPools []string `yaml:"delegator_pools"`
+	} `yaml:"accounts"`
+	Collectors []string `yaml:"collectors"`
+	Intervals  struct {
+		Poll          string `yaml:"poll"`
+		MaxCacheAge   string `yaml:"max_cache_age"`
+		FileSDRefresh string `yaml:"file_sd_refresh"`
+	} `yaml:"intervals"`
+	Flags map[string]string `yaml:"flags"`
+}
+
+// flagValues maps the config to flag names and values.
+func (c *fileConfig) flagValues() map[string]string {
+	res := make(map[string]string)
+	for name, value := range c.Flags {
+		res[name] = value
+	}
+	set := func(name string, value string) {
+		if value != "" {
+			res[name] = value
+		}
+	}
+	set("near.rpc-url", c.RPC.URL)
+	set("chain-url", c.RPC.ChainURL)
+	set("reference-url", c.RPC.ReferenceURL)
+	set("rpc-timeout", c.RPC.Timeout)
+	if c.RPC.Retries != nil {
+		set("rpc-retries", strconv.Itoa(*c.RPC.Retries))
+	}
+	set("rpc-backoff", c.RPC.Backoff)
+	var headers []string
+	for k, v := range c.RPC.Headers {
+		headers = append(headers, k+": "+v)
+	}
+	sort.Strings(headers)
+	set("rpc-header", strings.Join(headers, "\n"))
+	set("rpc-bearer-token", c.RPC.BearerToken)
+	set("rpc-basic-auth-user", c.RPC.BasicAuthUser)
+	set("rpc-basic-auth-password", c.RPC.BasicAuthPassword)
+	set("near.account-id", strings.Join(c.Accounts.Validators, ","))
+	set("balance-accounts", strings.Join(c.Accounts.Balances, ","))
+	set("delegator", c.Accounts.Delegator)
+	set("delegator-pools", strings.Join(c.Accounts.DelegatorPools, ","))
+	set("collectors", strings.Join(c.Collectors, ","))
+	set("poll-interval", c.Intervals.Poll)
+	set("max-cache-age", c.Intervals.MaxCacheAge)
+	set("file-sd-refresh", c.Intervals.FileSDRefresh)
+	return res
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c fileConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c.flagValues(), nil
+}
+
+// flagAliases maps deprecated flag names to the current ones. An alias
+// shares the value of its flag.
+var flagAliases = map[string]string{
+	"url":       "near.rpc-url",
+	"accountId": "near.account-id",
+	"addr":      "web.listen-address",
+}
+
+// canonicalFlag returns the current name of a possibly deprecated flag name.
+func canonicalFlag(name string) string {
+	if canonical, ok := flagAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+func addFlagAliases(fs *flag.FlagSet) {
+	for alias, name := range flagAliases {
+		fs.Var(fs.Lookup(name).Value, alias, "deprecated, use -"+name)
+	}
+}
+
+// cliFlags returns the names of the flags given on the command line.
+func cliFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[canonicalFlag(f.Name)] = true
+	})
+	return set
+}
+
+// loadConfig sets all flags not given on the command line from the
+// environment, or else from the config file, or else to their defaults. It
+// is run at startup and on every reload.
+func loadConfig(fs *flag.FlagSet, cli map[string]bool, configFile *string) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; err == nil && !ok && !cli[f.Name] {
+			err = fs.Set(f.Name, f.DefValue)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	for name := range cli {
+		set[name] = true
+	}
+	if err := applyEnv(fs, set); err != nil {
+		return err
+	}
+	if *configFile == "" {
+		return nil
+	}
+	values, err := readConfigFile(*configFile)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		name = canonicalFlag(name)
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown flag %q", *configFile, name)
+		}
+		if set[name] {
+			continue
+		}
+		if isSecretFlag(name) && strings.HasPrefix(value, "vault:") {
+			if value, err = vaultLookup(strings.TrimPrefix(value, "vault:")); err != nil {
+				return fmt.Errorf("%s: %s: %v", *configFile, name, err)
+			}
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %v", *configFile, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setEnv sets an environment variable and returns a function restoring it.
+func setEnv(t *testing.T, key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// newTestFlagSet returns the flags used by the config tests, parsed from
+// args, and the value of -config.file.
+func newTestFlagSet(t *testing.T, args ...string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("near.rpc-url", "http://localhost:3030", "")
+	fs.String("near.account-id", "", "")
+	fs.String("web.listen-address", ":9333", "")
+	fs.Duration("rpc-timeout", 0, "")
+	fs.Int("rpc-retries", 0, "")
+	fs.String("rpc-bearer-token", "", "")
+	fs.Var(&headerFlag{}, "rpc-header", "")
+	fs.String("collectors", "", "")
+	configFile := fs.String("config.file", "", "")
+	addFlagAliases(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs, configFile
+}
+
+func flagValue(fs *flag.FlagSet, name string) string {
+	return fs.Lookup(name).Value.String()
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	config := `
+rpc:
+  url: http://file:3030
+  timeout: 5s
+  retries: 2
+  headers:
+    X-Api-Key: key
+accounts:
+  validators: [a.test, b.test]
+flags:
+  collectors: node
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv(t, "NEAR_EXPORTER_RPC_TIMEOUT", "7s")()
+	defer setEnv(t, "NEAR_EXPORTER_NEAR_RPC_URL", "http://env:3030")()
+
+	fs, configFile := newTestFlagSet(t, "-config.file", path, "-url", "http://cli:3030", "-rpc-retries", "4")
+	cli := cliFlags(fs)
+	if err := loadConfig(fs, cli, configFile); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		// The command line wins, also through a deprecated alias.
+		"near.rpc-url": "http://cli:3030",
+		"rpc-retries":  "4",
+		// The environment wins over the config file.
+		"rpc-timeout": "7s",
+		// The config file wins over the defaults.
+		"near.account-id": "a.test,b.test",
+		"rpc-header":      "X-Api-Key: key",
+		"collectors":      "node",
+		// Defaults.
+		"web.listen-address": ":9333",
+		"rpc-bearer-token":   "",
+	}
+	for name, value := range want {
+		if got := flagValue(fs, name); got != value {
+			t.Errorf("-%s: got %q, want %q", name, got, value)
+		}
+	}
+
+	// On reload, values removed from the environment and the config file
+	// fall back to the defaults, the command line still wins.
+	os.Unsetenv("NEAR_EXPORTER_RPC_TIMEOUT")
+	if err := ioutil.WriteFile(path, []byte("rpc:\n  url: http://file:3030\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(fs, cli, configFile); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"near.rpc-url":    "http://cli:3030",
+		"rpc-retries":     "4",
+		"rpc-timeout":     "0s",
+		"near.account-id": "",
+		"rpc-header":      "",
+		"collectors":      "",
+	}
+	for name, value := range want {
+		if got := flagValue(fs, name); got != value {
+			t.Errorf("reload: -%s: got %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "unknown field", config: "rpc:\n  uri: http://file:3030\n", wantErr: "field uri not found"},
+		{name: "unknown flag", config: "flags:\n  no-such-flag: x\n", wantErr: `unknown flag "no-such-flag"`},
+		{name: "invalid value", config: "rpc:\n  timeout: soon\n", wantErr: "rpc-timeout"},
+		{name: "invalid header", config: "rpc:\n  headers:\n    \"\": x\n", wantErr: "is not of the form"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "config.yml")
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			fs, configFile := newTestFlagSet(t, "-config.file", path)
+			err = loadConfig(fs, cliFlags(fs), configFile)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
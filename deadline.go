@@ -0,0 +1,17 @@
+package main
+
+import (
+	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// withDeadline aborts the collections of c after timeout, counting them in
+// timeouts, if c supports cancellation and timeout is set.
+func withDeadline(name string, c prometheus.Collector, timeout time.Duration, timeouts *prometheus.CounterVec) prometheus.Collector {
+	if _, ok := c.(collector.ContextCollector); !ok || timeout <= 0 {
+		return c
+	}
+	return collector.WithTimeout(c, timeout, timeouts.WithLabelValues(name).Inc)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+)
+
+// rawHandler serves the last raw JSON-RPC responses per method. Bodies that
+// are not valid JSON (e.g. proxy error pages) are returned as strings. When
+// chain data is served by a separate client, its methods are prefixed with
+// "chain:".
+func rawHandler(clients func() (*nearapi.Client, *nearapi.Client)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodeClient, chainClient := clients()
+		res := make(map[string]json.RawMessage)
+		add := func(prefix string, client *nearapi.Client) {
+			for method, body := range client.RawResponses() {
+				if json.Valid([]byte(body)) {
+					res[prefix+method] = json.RawMessage(body)
+					continue
+				}
+				quoted, _ := json.Marshal(body)
+				res[prefix+method] = quoted
+			}
+		}
+		add("", nodeClient)
+		if chainClient != nodeClient {
+			add("chain:", chainClient)
+		}
+		writeJSON(w, http.StatusOK, res)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+)
+
+// discoveryBackoff is the delay before the first retry of the discovery at
+// startup, it doubles with every further retry up to maxPollBackoff.
+var discoveryBackoff = time.Second
+
+// discoverAccount returns the validator_account_id of the node, empty if the
+// node runs without validator key.
+func discoverAccount(client nearapi.RPC) (string, error) {
+	sr, err := client.Get("status", nil)
+	if err != nil {
+		return "", err
+	}
+	return sr.Status.ValidatorAccountId, nil
+}
+
+// waitForAccount discovers the validator account of the node, retrying until
+// its status can be read, so that an unreachable node does not start the
+// exporter without validator metrics.
+func waitForAccount(client nearapi.RPC) string {
+	backoff := discoveryBackoff
+	for {
+		id, err := discoverAccount(client)
+		if err == nil {
+			if id == "" {
+				logging.Warn("the node has no validator account, validator metrics are disabled")
+			}
+			return id
+		}
+		logging.Warn("discovering the validator account of the node failed", "err", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxPollBackoff {
+			backoff = maxPollBackoff
+		}
+	}
+}
+
+// watchAccount re-checks the validator account of the node every interval
+// and requests a reload when it differs from the one the exporter monitors,
+// e.g. after the validator key of the node was replaced.
+func watchAccount(interval time.Duration, current func() *exporter, reload chan<- os.Signal) {
+	for range time.Tick(interval) {
+		checkAccount(current(), reload)
+	}
+}
+
+// checkAccount requests a reload if the validator account of the node
+// differs from the one e monitors. Failed checks keep the account.
+func checkAccount(e *exporter, reload chan<- os.Signal) {
+	if !e.discovery {
+		return
+	}
+	id, err := discoverAccount(e.nodeClient)
+	if err != nil {
+		logging.Warn("checking the validator account of the node failed", "err", err)
+		return
+	}
+	if id != e.accountId {
+		logging.Info("the validator account of the node changed", "old", e.accountId, "new", id)
+		select {
+		case reload <- syscall.SIGHUP:
+		default:
+		}
+	}
+}
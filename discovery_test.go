@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+)
+
+func TestCheckAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		accountId  string
+		fail       bool
+		wantReload bool
+	}{
+		{name: "unchanged", accountId: rpctest.ValidatorId},
+		{name: "changed", accountId: "old.test", wantReload: true},
+		{name: "started without account", accountId: "", wantReload: true},
+		{name: "status error", accountId: rpctest.ValidatorId, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := rpctest.NewNode()
+			if tt.fail {
+				n.Fail("status", http.StatusBadGateway)
+			}
+			srv := rpctest.NewServer(n)
+			defer srv.Close()
+
+			reload := make(chan os.Signal, 1)
+			checkAccount(&exporter{nodeClient: nearapi.NewClient(srv.URL), discovery: true, accountId: tt.accountId}, reload)
+			if got := len(reload) == 1; got != tt.wantReload {
+				t.Errorf("reload requested %v, want %v", got, tt.wantReload)
+			}
+		})
+	}
+}
+
+func TestWaitForAccountRetries(t *testing.T) {
+	defer func(d time.Duration) { discoveryBackoff = d }(discoveryBackoff)
+	discoveryBackoff = time.Millisecond
+
+	n := rpctest.NewNode()
+	n.Fail("status", http.StatusServiceUnavailable)
+	srv := rpctest.NewServer(n)
+	defer srv.Close()
+	go func() {
+		for n.Calls("status") < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		n.Fail("status", 0)
+	}()
+
+	if id := waitForAccount(nearapi.NewClient(srv.URL)); id != rpctest.ValidatorId {
+		t.Errorf("got %q, want %q", id, rpctest.ValidatorId)
+	}
+}
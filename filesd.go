@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"gopkg.in/yaml.v2"
+)
+
+type fileSDGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// fileSD discovers targets from Prometheus file_sd files. Every host:port
+// becomes a target named after it. The reserved labels __scheme__ (http by
+// default) and __account_id__ set the RPC scheme and the validator account,
+// other labels starting with __ are dropped and the rest is attached to the
+// metrics of the target.
+type fileSD struct {
+	patterns []string
+	store    *targetStore
+	// refreshed are the modification times of the files of the last
+	// successful refresh.
+	refreshed map[string]time.Time
+}
+
+func newFileSD(patterns []string, store *targetStore) *fileSD {
+	return &fileSD{
+		patterns: patterns,
+		store:    store,
+	}
+}
+
+func (d *fileSD) files() ([]string, error) {
+	var files []string
+	for _, p := range d.patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// modTimes returns the modification times of files and whether files were
+// added, removed or modified since the last successful refresh.
+func (d *fileSD) modTimes(files []string) (map[string]time.Time, bool) {
+	modTimes := make(map[string]time.Time)
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			modTimes[f] = info.ModTime()
+		}
+	}
+	changed := d.refreshed == nil || len(modTimes) != len(d.refreshed)
+	for f, t := range modTimes {
+		if !d.refreshed[f].Equal(t) {
+			changed = true
+		}
+	}
+	return modTimes, changed
+}
+
+// Refresh re-reads the files if they changed. The files are read again on
+// the next refresh until they could be parsed and their targets applied, so
+// that files which were caught half-written are not skipped.
+func (d *fileSD) Refresh() error {
+	files, err := d.files()
+	if err != nil {
+		return err
+	}
+	modTimes, changed := d.modTimes(files)
+	if !changed {
+		return nil
+	}
+
+	var targets []Target
+	for _, f := range files {
+		groups, err := readFileSD(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+		for _, g := range groups {
+			for _, addr := range g.Targets {
+				targets = append(targets, fileSDTarget(addr, g.Labels))
+			}
+		}
+	}
+	if err := d.store.ReplaceSource("file_sd", targets); err != nil {
+		return err
+	}
+	d.refreshed = modTimes
+	return nil
+}
+
+// Run re-reads the files every interval until the process exits.
+func (d *fileSD) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := d.Refresh(); err != nil {
+			logging.Error("file_sd refresh failed", "err", err)
+		}
+	}
+}
+
+func readFileSD(path string) ([]fileSDGroup, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups []fileSDGroup
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &groups)
+	default:
+		err = json.Unmarshal(data, &groups)
+	}
+	return groups, err
+}
+
+func fileSDTarget(addr string, labels map[string]string) Target {
+	scheme := "http"
+	t := Target{Name: addr}
+	for k, v := range labels {
+		switch {
+		case k == "__scheme__":
+			scheme = v
+		case k == "__account_id__":
+			t.AccountId = v
+		case strings.HasPrefix(k, "__"):
+		default:
+			if t.Labels == nil {
+				t.Labels = make(map[string]string)
+			}
+			t.Labels[k] = v
+		}
+	}
+	t.URL = scheme + "://" + addr
+	return t
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestTargetStore(t *testing.T) *targetStore {
+	store, err := newTargetStore("", nearapi.NewClient, func(Target, *nearapi.Client) prometheus.Gatherer { return prometheus.NewRegistry() }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// writeFile writes data to path with the modification time mtime.
+func writeFile(t *testing.T, path string, data string, mtime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const fileSDTargets = `
+- targets: [node1:3030, node2:3030]
+  labels:
+    __scheme__: https
+    __account_id__: pool.test
+    __meta_ignored: x
+    env: prod
+`
+
+func TestFileSDRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.yml")
+	mtime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	store := newTestTargetStore(t)
+	d := newFileSD([]string{filepath.Join(dir, "*.yml")}, store)
+
+	// A half-written file fails and is read again although its
+	// modification time did not change.
+	writeFile(t, path, "- targets: [node1:3030", mtime)
+	if err := d.Refresh(); err == nil {
+		t.Fatal("want an error for the half-written file")
+	}
+	writeFile(t, path, fileSDTargets, mtime)
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	want := []Target{
+		{Name: "node1:3030", URL: "https://node1:3030", AccountId: "pool.test", Labels: map[string]string{"env": "prod"}, Source: "file_sd"},
+		{Name: "node2:3030", URL: "https://node2:3030", AccountId: "pool.test", Labels: map[string]string{"env": "prod"}, Source: "file_sd"},
+	}
+	if got := store.List(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.List(); len(got) != 0 {
+		t.Errorf("got %+v after removing the file, want no targets", got)
+	}
+}
@@ -1,5 +1,11 @@
-module github.com/masknetgoal634/near-exporter
+module github.com/madnadyka/near-prometheus-exporter
 
 go 1.13
 
-require github.com/prometheus/client_golang v1.6.0
+require (
+	github.com/golang/snappy v0.0.1
+	github.com/prometheus/client_golang v1.6.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.9.1
+	gopkg.in/yaml.v2 v2.2.5
+)
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// runHealthcheck queries /healthz of a running exporter and exits with 0 when
+// it is healthy, 1 otherwise.
+func runHealthcheck(args []string) {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	addr := fs.String("addr", ":9333", "listen address of the exporter")
+	timeout := fs.Duration("timeout", 5*time.Second, "request timeout")
+	useTLS := fs.Bool("tls", false, "query the exporter over HTTPS, without verifying its certificate")
+	fs.Parse(args)
+
+	host := *addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	client := &http.Client{Timeout: *timeout}
+	scheme := "http"
+	if *useTLS {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	r, err := client.Get(scheme + "://" + host + "/healthz")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		fmt.Fprintln(os.Stderr, "unhealthy:", r.Status)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
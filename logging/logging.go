@@ -0,0 +1,151 @@
+// Package logging writes leveled, structured log lines to stderr, either in
+// logfmt or as JSON objects, one per line.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+var (
+	mu         sync.Mutex
+	out        io.Writer = os.Stderr
+	minLevel             = LevelInfo
+	jsonFormat bool
+)
+
+// Configure sets the minimum level logged and the format, logfmt or json.
+func Configure(level string, format string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if format != "logfmt" && format != "json" {
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	minLevel, jsonFormat = l, format == "json"
+	return nil
+}
+
+func Debug(msg string, keyvals ...interface{}) { Log(LevelDebug, msg, keyvals...) }
+func Info(msg string, keyvals ...interface{})  { Log(LevelInfo, msg, keyvals...) }
+func Warn(msg string, keyvals ...interface{})  { Log(LevelWarn, msg, keyvals...) }
+func Error(msg string, keyvals ...interface{}) { Log(LevelError, msg, keyvals...) }
+
+// Fatal logs at error level and exits with 1.
+func Fatal(msg string, keyvals ...interface{}) {
+	Log(LevelError, msg, keyvals...)
+	os.Exit(1)
+}
+
+// Log writes msg with the alternating keys and values in keyvals, if level
+// is enabled.
+func Log(level Level, msg string, keyvals ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < minLevel {
+		return
+	}
+	kvs := append([]interface{}{"ts", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg}, keyvals...)
+	if len(kvs)%2 != 0 {
+		kvs = append(kvs, "(MISSING)")
+	}
+	var buf bytes.Buffer
+	if jsonFormat {
+		writeJSON(&buf, kvs)
+	} else {
+		writeLogfmt(&buf, kvs)
+	}
+	buf.WriteByte('\n')
+	out.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, kvs []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(fmt.Sprint(kvs[i]))
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(jsonValue(kvs[i+1]))
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(kvs[i+1]))
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func writeLogfmt(buf *bytes.Buffer, kvs []interface{}) {
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(kvs[i]))
+		buf.WriteByte('=')
+		v := fmt.Sprint(kvs[i+1])
+		if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+}
+
+type writer Level
+
+func (w writer) Write(p []byte) (int, error) {
+	Log(Level(w), strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// Writer returns a writer logging every write as a message at the given
+// level, to redirect the standard log package.
+func Writer(level Level) io.Writer {
+	return writer(level)
+}
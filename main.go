@@ -1,26 +1,75 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	nearapi "github.com/masknetgoal634/near-exporter/client"
-	"github.com/masknetgoal634/near-exporter/collector"
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/collector"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/madnadyka/near-prometheus-exporter/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
+// exporter holds the clients and collectors, which are rebuilt on reload.
+type exporter struct {
+	nodeClient *nearapi.Client
+	client     *nearapi.Client
+	// opts are the options of the collectors, clients the one of the RPC
+	// clients, timeout is -scrape-timeout, lite is set with -lite and flags
+	// are the effective flag values. The HTTP handlers read them instead of
+	// the flags, which a reload changes.
+	opts       collector.Options
+	clients    clientConfig
+	timeout    time.Duration
+	lite       bool
+	flags      map[string]string
+	collectors []string
+	poller     *poller
+	gatherer   prometheus.Gatherer
+	// discovery is set when the monitored account is the validator account
+	// of the node, accountId is the one discovered.
+	discovery bool
+	accountId string
+}
+
+// accountIdPattern matches valid NEAR account ids, which are also at most 64
+// characters long.
+var accountIdPattern = regexp.MustCompile(`^(([a-z\d]+[-_])*[a-z\d]+\.)*([a-z\d]+[-_])*[a-z\d]+$`)
+
 func main() {
 	var version = "undefined"
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "healthcheck":
+			runHealthcheck(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Usage = func() {
 		const (
-			usage = "Usage: near_exporter [option] [arg]\n\n" +
+			usage = "Usage: near_exporter [option] [arg]\n" +
+				"       near_exporter bench [option] [arg]\n" +
+				"       near_exporter healthcheck [option] [arg]\n\n" +
 				"Prometheus exporter for Near node metrics\n\n" +
-				"Options and arguments:\n"
+				"Options and arguments (also settable as NEAR_EXPORTER_<OPTION> environment variables or in -config.file):\n"
 		)
 
 		fmt.Fprint(flag.CommandLine.Output(), usage)
@@ -29,33 +78,458 @@ func main() {
 		os.Exit(2)
 	}
 
-	url := flag.String("url", "http://localhost:3030", "Near JSON-RPC URL")
-	addr := flag.String("addr", ":9333", "listen address")
-	accountId := flag.String("accountId", "test", "Validator account id")
+	configFile := flag.String("config.file", "", "YAML config file, re-read on SIGHUP")
+	enabledCollectors := flag.String("collectors", "", "comma separated collectors to enable, all applicable if empty")
+	url := flag.String("near.rpc-url", "http://localhost:3030", "Near JSON-RPC URL")
+	chainUrl := flag.String("chain-url", "", "Near JSON-RPC URL for chain data (validators, contracts), defaults to -near.rpc-url")
+	rpcTimeout := flag.Duration("rpc-timeout", 10*time.Second, "timeout of a single RPC request")
+	rpcRetries := flag.Int("rpc-retries", 0, "number of times a failed RPC request is repeated")
+	rpcCacheTTL := flag.Duration("rpc-cache-ttl", 2*time.Second, "reuse RPC responses for this long and share concurrent identical calls, 0 disables")
+	rpcBackoff := flag.Duration("rpc-backoff", 500*time.Millisecond, "delay before the first retry of a failed RPC request, doubled for every further retry")
+	var rpcHeaders headerFlag
+	flag.Var(&rpcHeaders, "rpc-header", "HTTP header sent with every RPC request, as \"Name: value\", may be repeated")
+	rpcBearerToken := flag.String("rpc-bearer-token", "", "bearer token authenticating RPC requests")
+	rpcBasicAuthUser := flag.String("rpc-basic-auth-user", "", "basic auth user authenticating RPC requests")
+	rpcBasicAuthPassword := flag.String("rpc-basic-auth-password", "", "password of -rpc-basic-auth-user")
+	neardMetricsURL := flag.String("neard-metrics-url", "", "Prometheus endpoint of neard, e.g. http://localhost:3030/metrics, to serve its metrics in -neard-metrics-allowlist as well")
+	neardMetricsAllowlist := flag.String("neard-metrics-allowlist", "near_peer_message_received_total,process_resident_memory_bytes,process_virtual_memory_bytes,process_cpu_seconds_total,process_open_fds", "comma separated regular expressions of the neard metric names to serve")
+	recentBlocks := flag.Int("recent-blocks", 10, "number of latest blocks block time and chunk metrics are computed from")
+	referenceUrl := flag.String("reference-url", "", "JSON-RPC URL of a reference node, e.g. https://rpc.mainnet.near.org, to export how far the node is behind")
+	addr := flag.String("web.listen-address", ":9333", "listen address")
+	telemetryPath := flag.String("web.telemetry-path", "/metrics", "path under which to expose metrics")
+	accountId := flag.String("near.account-id", "", "Validator account id, comma separated to monitor several accounts, the validator account of the node if empty")
+	accountDiscoveryInterval := flag.Duration("account-discovery-interval", 5*time.Minute, "how often the validator account of the node is re-checked when -near.account-id is empty")
+	blockId := flag.String("block-id", "", "pin validator, delegator and protocol queries to a block height or hash (archival nodes)")
+	allPools := flag.Bool("all-pools", false, "export delegator aggregates of all current validators")
+	allPoolsBatch := flag.Int("all-pools-batch", 10, "maximum number of pools re-queried per scrape in all-pools mode")
+	pollInterval := flag.Duration("poll-interval", 0, "collect in the background every interval and serve the cached metrics, 0 collects on every scrape")
+	maxCacheAge := flag.Duration("max-cache-age", 0, "cached values older than this are not exported, 0 disables the limit")
+	delegatorsPageSize := flag.Int("delegators-page-size", collector.DefaultDelegatorsPageSize, "number of delegators requested per get_accounts call")
+	maxDelegators := flag.Int("max-delegators", collector.DefaultMaxDelegators, "maximum number of delegators read from a staking pool")
+	amountUnit := flag.String("amount-unit", "near", "unit stakes and balances are exported in: near, millinear or yoctonear")
+	rawYocto := flag.Bool("raw-yocto", false, "also export stakes and balances in yoctoNEAR as *_yocto metrics")
+	whitelistAccount := flag.String("whitelist-account", collector.DefaultWhitelistAccountId, "staking pool whitelist contract of lockup accounts, empty disables the whitelist check")
+	allProposals := flag.Bool("all-proposals", false, "export the stake of every account in current proposals")
+	balanceAccounts := flag.String("balance-accounts", "", "comma separated account ids to export the balances of, e.g. the account signing staking proposals")
+	delegator := flag.String("delegator", "", "delegator account id, exports its balances per staking pool instead of validator metrics")
+	delegatorPools := flag.String("delegator-pools", "", "comma separated staking pools of the delegator, discovered among current validators if empty")
+	stateFile := flag.String("state-file", "", "JSON file to persist the produced and expected block and chunk totals of the validators across restarts")
+	cacheDir := flag.String("cache-dir", "", "directory to persist the last good validators, protocol config and view call responses, served when the RPC fails")
+	watchdogTimeout := flag.Duration("watchdog-timeout", 5*time.Minute, "collections running longer than this are reported as stuck, 0 disables the watchdog")
+	watchdogExit := flag.Bool("watchdog-exit", false, "terminate the exporter when a collection is stuck, so that a supervisor restarts it")
+	chainLabels := flag.Bool("chain-labels", false, "add the chain_id and genesis_hash of the node as labels to all metrics")
+	lite := flag.Bool("lite", false, "collect node status metrics only, without validator and delegator metrics")
+	versionBuild := flag.Bool("version-build-metric", true, "also export the deprecated near_version_build metric, -version-build-metric=false turns it off")
+	versionBuildHash := flag.Bool("version-build-hash", false, "export the FNV hash of the build as near_version_build value instead of 1 (migration only)")
+	exemplars := flag.Bool("exemplars", false, "export block and epoch height counters with OpenMetrics exemplars")
+	tlsCertFile := flag.String("web-tls-cert-file", "", "serve HTTPS with this certificate, requires -web-tls-key-file")
+	tlsKeyFile := flag.String("web-tls-key-file", "", "private key of -web-tls-cert-file")
+	basicAuthUser := flag.String("web-basic-auth-user", "", "require basic auth with this user for /metrics and the debug endpoints")
+	basicAuthPassword := flag.String("web-basic-auth-password", "", "password of -web-basic-auth-user")
+	webToken := flag.String("web-bearer-token", "", "require this bearer token for /metrics and the debug endpoints, alternatively to basic auth")
+	adminToken := flag.String("admin-token", "", "bearer token enabling the /api/v1/targets admin API")
+	targetsFile := flag.String("targets-file", "", "file to persist targets managed through the admin API")
+	gateMetrics := flag.Bool("gate-metrics", false, "respond to /metrics with 503 until the first collection succeeded")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP endpoint to export traces of collection cycles to, e.g. http://localhost:4318")
+	fileSDFiles := flag.String("file-sd", "", "comma separated Prometheus file_sd files (JSON or YAML, globs allowed) to discover targets from")
+	fileSDRefresh := flag.Duration("file-sd-refresh", 30*time.Second, "how often the file_sd files are checked for changes")
+	dumpRaw := flag.Bool("dump-raw", false, "expose the last raw RPC responses on /debug/raw")
+	pushGatewayURL := flag.String("push-gateway-url", "", "Pushgateway URL to push the metrics to, for hosts which can't be scraped")
+	pushRemoteWriteURL := flag.String("push-remote-write-url", "", "Prometheus remote_write URL to push the metrics to, e.g. http://prometheus:9090/api/v1/write")
+	pushInterval := flag.Duration("push-interval", 30*time.Second, "how often the metrics are pushed")
+	pushJob := flag.String("push-job", "near_exporter", "job label of the pushed metrics")
+	pushInstance := flag.String("push-instance", "", "instance label of the pushed metrics, defaults to the hostname")
+	pushBasicAuthUser := flag.String("push-basic-auth-user", "", "basic auth user of the push endpoints")
+	pushBasicAuthPassword := flag.String("push-basic-auth-password", "", "password of -push-basic-auth-user")
+	pushBearerToken := flag.String("push-bearer-token", "", "bearer token of the push endpoints")
+	scrapeTimeout := flag.Duration("scrape-timeout", 0, "abort collections after this long and return the metrics collected so far, 0 disables the deadline")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for in-flight requests on SIGTERM")
+	logLevel := flag.String("log-level", "info", "minimum level of log messages: debug, info, warn or error")
+	logFormat := flag.String("log-format", "logfmt", "format of log messages: logfmt or json")
 	ver := flag.Bool("v", false, "print version number and exit")
+	printAlertRules := flag.Bool("print-rules", false, "print Prometheus alerting rules for the exported metrics and exit")
+	addFlagAliases(flag.CommandLine)
 
 	flag.Parse()
 	if len(flag.Args()) > 0 {
 		flag.Usage()
 	}
+	cli := cliFlags(flag.CommandLine)
+	if err := loadConfig(flag.CommandLine, cli, configFile); err != nil {
+		logging.Fatal("loading configuration failed", "err", err)
+	}
+	if err := logging.Configure(*logLevel, *logFormat); err != nil {
+		logging.Fatal("invalid logging configuration", "err", err)
+	}
+	// Messages of the standard log package, e.g. of net/http, are logged as
+	// errors.
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer(logging.LevelError))
 
 	if *ver {
 		fmt.Println(version)
 		os.Exit(0)
 	}
+	if *printAlertRules {
+		if err := printRules(os.Stdout); err != nil {
+			logging.Fatal("printing rules failed", "err", err)
+		}
+		os.Exit(0)
+	}
+
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		logging.Fatal("-web-tls-cert-file and -web-tls-key-file must be set together")
+	}
+	auth := webAuth{user: *basicAuthUser, password: *basicAuthPassword, token: *webToken}
+
+	var tracer *tracing.Tracer
+	if *otlpEndpoint != "" {
+		tracer = tracing.NewTracer(*otlpEndpoint, "near-exporter")
+		go tracer.Run(5 * time.Second)
+	}
+
+	production, err := collector.NewProductionState(*stateFile)
+	if err != nil {
+		logging.Fatal("loading the state file failed", "path", *stateFile, "err", err)
+	}
+
+	rpcMetrics := nearapi.NewMetrics()
+	stats := newCollectorStats(version)
+	var wd *watchdog
+	if *watchdogTimeout > 0 {
+		wd = newWatchdog(*watchdogTimeout, *watchdogExit)
+		go wd.Run()
+	}
+
+	ready := &readiness{}
+
+	// instrument wraps a collector with the watchdog, the scrape deadline,
+	// tracing and the collector stats. The watchdog is inside the deadline
+	// so that it sees collections hanging past it, the trace span reaches
+	// the RPC calls through the context the deadline passes on. The
+	// collection spans are children of the gatherings of scope.
+	instrument := func(scope *tracing.Scope, name string, c prometheus.Collector, timeout time.Duration) prometheus.Collector {
+		if wd != nil {
+			c = wd.Wrap(name, c)
+		}
+		c = withDeadline(name, c, timeout, stats.timeouts)
+		c = scope.WrapCollector(name, c)
+		return stats.Wrap(name, c)
+	}
+
+	// build creates the clients and collectors from the current flags, at
+	// startup and on every reload.
+	build := func() (*exporter, error) {
+		unit, err := collector.ParseUnit(*amountUnit)
+		if err != nil {
+			return nil, err
+		}
+		settings := collector.Settings{
+			Unit:               unit,
+			RawYocto:           *rawYocto,
+			WhitelistAccountId: *whitelistAccount,
+			DelegatorsPageSize: *delegatorsPageSize,
+			MaxDelegators:      *maxDelegators,
+		}
+
+		// The node client is only used for the status of the node itself,
+		// chain data may be served by a different, e.g. public, RPC so that
+		// heavy view calls never load the validator node.
+		clients := clientConfig{
+			timeout:           *rpcTimeout,
+			retries:           *rpcRetries,
+			backoff:           *rpcBackoff,
+			cacheTTL:          *rpcCacheTTL,
+			header:            rpcHeaders.header.Clone(),
+			basicAuthUser:     *rpcBasicAuthUser,
+			basicAuthPassword: *rpcBasicAuthPassword,
+			bearerToken:       *rpcBearerToken,
+			tracer:            tracer,
+			metrics:           rpcMetrics,
+		}
+		e := &exporter{nodeClient: clients.newClient(*url), clients: clients, timeout: *scrapeTimeout, lite: *lite, flags: effectiveFlags(flag.CommandLine)}
+		e.client = e.nodeClient
+		if *chainUrl != "" && *chainUrl != *url {
+			e.client = clients.newClient(*chainUrl)
+		}
+		client := e.client
+		if *cacheDir != "" {
+			if err := client.EnableDiskCache(*cacheDir, *maxCacheAge, "validators", "EXPERIMENTAL_protocol_config", "query"); err != nil {
+				return nil, err
+			}
+		}
+		if *dumpRaw {
+			e.nodeClient.EnableRawDump()
+			client.EnableRawDump()
+		}
+
+		registry := prometheus.NewPedanticRegistry()
+		scope := tracing.NewScope(tracer)
+		if wd != nil {
+			wd.Reset()
+			registry.MustRegister(wd)
+		}
+		registry.MustRegister(rpcMetrics)
+		registry.MustRegister(stats)
+		enabled := make(map[string]bool)
+		for _, name := range strings.Split(*enabledCollectors, ",") {
+			if name != "" {
+				enabled[name] = true
+			}
+		}
+		// Collectors of one of several accounts are named <collector>/<account>
+		// and their metrics labeled with the account.
+		register := func(name string, c prometheus.Collector, labels prometheus.Labels) {
+			if len(enabled) > 0 && !enabled[strings.Split(name, "/")[0]] {
+				return
+			}
+			prometheus.WrapRegistererWith(labels, registry).MustRegister(instrument(scope, name, c, *scrapeTimeout))
+			e.collectors = append(e.collectors, name)
+		}
+
+		if *cacheDir != "" {
+			register("cache", collector.NewCacheMetrics(client), nil)
+		}
+		opts := collector.Options{
+			Client:             client,
+			NodeClient:         e.nodeClient,
+			BlockId:            *blockId,
+			RecentBlocks:       *recentBlocks,
+			Exemplars:          *exemplars,
+			AllProposals:       *allProposals,
+			VersionBuildMetric: *versionBuild,
+			VersionBuildHash:   *versionBuildHash,
+			Lite:               *lite || *delegator != "",
+			Production:         production,
+			Settings:           settings,
+			Delegator:          *delegator,
+			AllPools:           *allPools,
+			AllPoolsBatch:      *allPoolsBatch,
+			MaxCacheAge:        *maxCacheAge,
+		}
+		if *referenceUrl != "" {
+			// No credentials, they are meant for the own RPC.
+			referenceClient := nearapi.NewClient(*referenceUrl)
+			referenceClient.SetTimeout(*rpcTimeout)
+			referenceClient.Tracer = tracer
+			referenceClient.Metrics = rpcMetrics
+			opts.ReferenceClient = referenceClient
+		}
+		if *delegatorPools != "" {
+			opts.DelegatorPools = strings.Split(*delegatorPools, ",")
+		}
+		if *balanceAccounts != "" {
+			opts.BalanceAccounts = strings.Split(*balanceAccounts, ",")
+		}
+		if !opts.Lite {
+			opts.Accounts = strings.Split(*accountId, ",")
+			if *accountId == "" {
+				e.discovery, e.accountId = true, waitForAccount(e.nodeClient)
+				opts.Accounts = nil
+				if e.accountId != "" {
+					logging.Info("monitoring the validator account of the node", "account_id", e.accountId)
+					opts.Accounts = []string{e.accountId}
+				}
+			}
+			if len(opts.Accounts) > 1 && *allProposals {
+				logging.Warn("-all-proposals is ignored with several accounts")
+			}
+		}
+		e.opts = opts
+		for _, c := range collector.New(opts) {
+			register(c.Name, c.Collector, c.Labels)
+		}
+		var gatherer prometheus.Gatherer = registry
+		if *neardMetricsURL != "" && (len(enabled) == 0 || enabled["neard"]) {
+			neard, err := newNeardGatherer(*neardMetricsURL, *neardMetricsAllowlist, &http.Client{Timeout: *rpcTimeout})
+			if err != nil {
+				return nil, err
+			}
+			gatherer = prometheus.Gatherers{registry, neard}
+			e.collectors = append(e.collectors, "neard")
+		}
+		e.poller = newPoller(scope.WrapGatherer(gatherer), *pollInterval, ready.Set)
+		e.gatherer = e.poller
+		if *chainLabels {
+			e.gatherer = &chainLabelGatherer{Gatherer: e.poller, client: e.nodeClient}
+		}
+		go e.poller.Run()
+		return e, nil
+	}
 
-	client := nearapi.NewClient(*url)
+	var state atomic.Value
+	e, err := build()
+	if err != nil {
+		logging.Fatal("starting exporter failed", "err", err)
+	}
+	state.Store(e)
+	current := func() *exporter { return state.Load().(*exporter) }
 
-	registry := prometheus.NewPedanticRegistry()
-	registry.MustRegister(
-		collector.NewNodeRpcMetrics(client, *accountId),
-	)
+	// SIGHUP is handled once all startup-only flags are read, see below.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	if *accountDiscoveryInterval > 0 {
+		go watchAccount(*accountDiscoveryInterval, current, hup)
+	}
 
-	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
-		ErrorLog:      log.New(os.Stderr, log.Prefix(), log.Flags()),
-		ErrorHandling: promhttp.ContinueOnError,
+	if *dumpRaw {
+		http.Handle("/debug/raw", auth.Wrap(rawHandler(func() (*nearapi.Client, *nearapi.Client) {
+			return current().nodeClient, current().client
+		})))
+	}
+
+	handlerOpts := promhttp.HandlerOpts{
+		ErrorLog:          log.New(logging.Writer(logging.LevelError), "", 0),
+		ErrorHandling:     promhttp.ContinueOnError,
+		EnableOpenMetrics: *exemplars,
+	}
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return current().gatherer.Gather()
 	})
+	handler := promhttp.HandlerFor(gatherer, handlerOpts)
+	if *gateMetrics {
+		handler = gateHandler(ready, gatherer, handlerOpts)
+	}
+	http.HandleFunc("/healthz", healthzHandler)
+	http.Handle("/ready", readyHandler(ready))
+	http.Handle("/readyz", nodeReadyHandler(func() *nearapi.Client { return current().nodeClient }))
 
-	http.Handle("/metrics", handler)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	var pt *pushTarget
+	if *pushGatewayURL != "" || *pushRemoteWriteURL != "" {
+		instance := *pushInstance
+		if instance == "" {
+			instance, _ = os.Hostname()
+		}
+		pt = &pushTarget{
+			gatewayURL:     *pushGatewayURL,
+			remoteWriteURL: *pushRemoteWriteURL,
+			job:            *pushJob,
+			instance:       instance,
+			user:           *pushBasicAuthUser,
+			password:       *pushBasicAuthPassword,
+			token:          *pushBearerToken,
+			httpClient:     &http.Client{Timeout: 30 * time.Second},
+			stop:           make(chan struct{}),
+			done:           make(chan struct{}),
+		}
+		go pt.Run(gatherer, *pushInterval)
+	}
+
+	newTargetClient := func(endpoint string) *nearapi.Client { return current().clients.newClient(endpoint) }
+	targets, err := newTargetStore(*targetsFile, newTargetClient, func(t Target, targetClient *nearapi.Client) prometheus.Gatherer {
+		targetRegistry := prometheus.NewPedanticRegistry()
+		r := prometheus.WrapRegistererWith(t.Labels, targetRegistry)
+		opts := current().opts
+		r.MustRegister(collector.NewNodeRpcMetrics(targetClient, opts.VersionBuildMetric, opts.VersionBuildHash, opts.Exemplars))
+		if t.AccountId != "" {
+			r.MustRegister(collector.NewValidatorMetrics(targetClient, t.AccountId, opts.BlockId, opts.Exemplars, opts.AllProposals, nil, opts.Settings))
+		}
+		return targetRegistry
+	}, *maxCacheAge)
+	if err != nil {
+		logging.Fatal("loading targets failed", "err", err)
+	}
+	if *fileSDFiles != "" {
+		sd := newFileSD(strings.Split(*fileSDFiles, ","), targets)
+		if err := sd.Refresh(); err != nil {
+			logging.Fatal("file_sd failed", "err", err)
+		}
+		go sd.Run(*fileSDRefresh)
+	}
+	if *adminToken != "" {
+		http.Handle("/api/v1/targets", requireToken(*adminToken, targetsHandler(targets)))
+		http.Handle("/api/v1/targets/", requireToken(*adminToken, targetsHandler(targets)))
+	}
+
+	// ?target= collects the metrics of a target managed through the admin
+	// API, ?account_id= the validator metrics of an ad-hoc account instead of
+	// the configured one.
+	http.Handle(*telemetryPath, auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.URL.Query().Get("target"); name != "" {
+			targetGatherer, ok := targets.Get(name)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			promhttp.HandlerFor(targetGatherer, handlerOpts).ServeHTTP(w, r)
+			return
+		}
+
+		id := r.URL.Query().Get("account_id")
+		e := current()
+		if id == "" || e.lite {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if !accountIdPattern.MatchString(id) || len(id) > 64 {
+			http.Error(w, "invalid account_id", http.StatusBadRequest)
+			return
+		}
+		accountRegistry := prometheus.NewPedanticRegistry()
+		scope := tracing.NewScope(tracer)
+		accountRegistry.MustRegister(instrument(scope, "account_id", collector.NewValidatorMetrics(e.client, id, e.opts.BlockId, e.opts.Exemplars, e.opts.AllProposals, nil, e.opts.Settings), e.timeout))
+		promhttp.HandlerFor(scope.WrapGatherer(accountRegistry), handlerOpts).ServeHTTP(w, r)
+	})))
+	http.Handle("/api/v1/config", auth.Wrap(configHandler(func() *exporter { return current() })))
+
+	// SIGTERM and SIGINT stop accepting connections and wait for in-flight
+	// scrapes before exiting.
+	srv := &http.Server{Addr: *addr}
+	shutdown, certFile, keyFile := *shutdownTimeout, *tlsCertFile, *tlsKeyFile
+	stopped := make(chan struct{})
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-term
+		logging.Info("shutting down", "signal", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdown)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logging.Error("shutdown failed", "err", err)
+		}
+		current().poller.Stop()
+		if pt != nil {
+			pt.Stop()
+		}
+		if err := tracer.Flush(); err != nil {
+			logging.Warn("exporting spans failed", "err", err)
+		}
+		close(stopped)
+	}()
+
+	// SIGHUP re-reads the config file and the environment and rebuilds the
+	// clients and collectors. The listen address, TLS, authentication and
+	// the admin API are only configured at startup, the flags must not be
+	// read outside of build from here on.
+	go func() {
+		for range hup {
+			if err := loadConfig(flag.CommandLine, cli, configFile); err != nil {
+				logging.Error("reload failed", "err", err)
+				continue
+			}
+			if err := logging.Configure(*logLevel, *logFormat); err != nil {
+				logging.Error("reload failed", "err", err)
+				continue
+			}
+			e, err := build()
+			if err != nil {
+				logging.Error("reload failed", "err", err)
+				continue
+			}
+			old := current()
+			state.Store(e)
+			old.poller.Stop()
+			logging.Info("reloaded configuration")
+		}
+	}()
+	logging.Info("listening", "addr", srv.Addr, "version", version)
+	if certFile != "" {
+		err = srv.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		logging.Fatal("server failed", "err", err)
+	}
+	<-stopped
 }
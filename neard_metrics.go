@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// neardGatherer scrapes the Prometheus endpoint of neard and returns the
+// metric families in its allowlist, so that they are served on the port of
+// the exporter when the one of neard is firewalled.
+type neardGatherer struct {
+	url        string
+	allowlist  []*regexp.Regexp
+	httpClient *http.Client
+}
+
+// newNeardGatherer creates the gatherer for the comma separated metric name
+// patterns in allowlist. Patterns match whole names.
+func newNeardGatherer(url string, allowlist string, httpClient *http.Client) (*neardGatherer, error) {
+	g := &neardGatherer{url: url, httpClient: httpClient}
+	for _, p := range strings.Split(allowlist, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("neard metrics allowlist: %v", err)
+		}
+		g.allowlist = append(g.allowlist, re)
+	}
+	return g, nil
+}
+
+func (g *neardGatherer) allowed(name string) bool {
+	for _, re := range g.allowlist {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *neardGatherer) Gather() ([]*dto.MetricFamily, error) {
+	r, err := g.httpClient.Get(g.url)
+	if err != nil {
+		return nil, fmt.Errorf("neard metrics: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("neard metrics: %s", r.Status)
+	}
+	var parser expfmt.TextParser
+	mfs, err := parser.TextToMetricFamilies(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("neard metrics: %v", err)
+	}
+	var res []*dto.MetricFamily
+	for name, mf := range mfs {
+		if g.allowed(name) && len(mf.Metric) > 0 {
+			res = append(res, mf)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].GetName() < res[j].GetName() })
+	return res, nil
+}
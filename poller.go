@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxPollBackoff bounds the delay between the retries of the first
+// collection with a zero interval.
+const maxPollBackoff = time.Minute
+
+// poller collects in the background and serves the last collected metrics,
+// so that scrapes neither wait for nor load the RPC. With a zero interval
+// every Gather collects synchronously.
+type poller struct {
+	gatherer    prometheus.Gatherer
+	interval    time.Duration
+	backoff     time.Duration
+	self        *prometheus.Registry
+	lastSuccess prometheus.Gauge
+	stop        chan struct{}
+	onSuccess   func()
+
+	mu     sync.RWMutex
+	polled bool
+	mfs    []*dto.MetricFamily
+	err    error
+}
+
+// newPoller creates a poller of g. onSuccess, if not nil, is called after
+// every collection which completed without errors.
+func newPoller(g prometheus.Gatherer, interval time.Duration, onSuccess func()) *poller {
+	p := &poller{
+		gatherer:  g,
+		interval:  interval,
+		backoff:   time.Second,
+		onSuccess: onSuccess,
+		self:      prometheus.NewRegistry(),
+		stop:      make(chan struct{}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "near_exporter_last_successful_scrape_timestamp",
+			Help: "Unix time of the last collection which completed without errors",
+		}),
+	}
+	p.self.MustRegister(p.lastSuccess)
+	return p
+}
+
+func (p *poller) poll() ([]*dto.MetricFamily, error) {
+	mfs, err := p.gatherer.Gather()
+	if err == nil {
+		p.lastSuccess.SetToCurrentTime()
+		if p.onSuccess != nil {
+			p.onSuccess()
+		}
+	}
+	return mfs, err
+}
+
+// Poll collects and replaces the cached metrics.
+func (p *poller) Poll() {
+	mfs, err := p.poll()
+	if err != nil {
+		logging.Warn("poll failed", "err", err)
+	}
+	p.mu.Lock()
+	p.mfs, p.err, p.polled = mfs, err, true
+	p.mu.Unlock()
+}
+
+// Run polls every interval until Stop is called. With a zero interval it
+// collects once at startup, retrying with a backoff until a collection
+// succeeds, so that readiness does not wait for the first scrape.
+func (p *poller) Run() {
+	if p.interval <= 0 {
+		p.pollUntilSuccess()
+		return
+	}
+	p.Poll()
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.Poll()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *poller) pollUntilSuccess() {
+	backoff := p.backoff
+	for {
+		_, err := p.poll()
+		if err == nil {
+			return
+		}
+		logging.Warn("initial collection failed", "err", err, "retry_in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-p.stop:
+			return
+		}
+		if backoff *= 2; backoff > maxPollBackoff {
+			backoff = maxPollBackoff
+		}
+	}
+}
+
+func (p *poller) Stop() {
+	close(p.stop)
+}
+
+func (p *poller) Gather() ([]*dto.MetricFamily, error) {
+	var mfs []*dto.MetricFamily
+	var err error
+	if p.interval <= 0 {
+		mfs, err = p.poll()
+	} else {
+		p.mu.RLock()
+		polled := p.polled
+		p.mu.RUnlock()
+		if !polled {
+			p.Poll()
+		}
+		p.mu.RLock()
+		mfs, err = p.mfs, p.err
+		p.mu.RUnlock()
+	}
+	return prometheus.Gatherers{
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, err }),
+		p.self,
+	}.Gather()
+}
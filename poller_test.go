@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/client/rpctest"
+	"github.com/madnadyka/near-prometheus-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// waitReady polls the /ready handler of r until it responds with 200.
+func waitReady(t *testing.T, r *readiness) {
+	handler := readyHandler(r)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+		if rec.Code == http.StatusOK {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/ready responded with %d", rec.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPollerReadyWithoutScrape(t *testing.T) {
+	srv := rpctest.NewServer(rpctest.NewNode())
+	defer srv.Close()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector.NewNodeRpcMetrics(nearapi.NewClient(srv.URL), false, false, false))
+
+	ready := &readiness{}
+	p := newPoller(registry, 0, ready.Set)
+	go p.Run()
+	defer p.Stop()
+	waitReady(t, ready)
+}
+
+func TestPollerRetriesFirstCollection(t *testing.T) {
+	var calls int32
+	g := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return nil, nil
+	})
+	ready := &readiness{}
+	p := newPoller(g, 0, ready.Set)
+	p.backoff = time.Millisecond
+	go p.Run()
+	defer p.Stop()
+	waitReady(t, ready)
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("collected %d times, want 3", n)
+	}
+}
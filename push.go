@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// pushTarget periodically pushes the metrics of the exporter to a Pushgateway
+// or a Prometheus remote_write endpoint, for hosts which can't be scraped,
+// e.g. behind NAT. The job and instance labels identify the exporter.
+type pushTarget struct {
+	gatewayURL     string
+	remoteWriteURL string
+	job            string
+	instance       string
+	user           string
+	password       string
+	token          string
+	httpClient     *http.Client
+	stop           chan struct{}
+	done           chan struct{}
+}
+
+// Run pushes every interval until Stop is called.
+func (p *pushTarget) Run(g prometheus.Gatherer, interval time.Duration) {
+	defer close(p.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := p.Push(g); err != nil {
+			logging.Warn("push failed", "err", err)
+		}
+		select {
+		case <-t.C:
+		case <-p.stop:
+			// The final push, so that the last values before the exporter
+			// exits aren't lost.
+			if err := p.Push(g); err != nil {
+				logging.Warn("push failed", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// Stop stops Run after a final push and waits for it.
+func (p *pushTarget) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+// Push gathers and pushes the metrics once. Metrics of failed collectors are
+// left out, the rest is pushed.
+func (p *pushTarget) Push(g prometheus.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		logging.Warn("collection failed, pushing partial metrics", "err", err)
+	}
+	if p.gatewayURL != "" {
+		pusher := push.New(p.gatewayURL, p.job).
+			Grouping("instance", p.instance).
+			Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil })).
+			Client(p)
+		if p.user != "" {
+			pusher = pusher.BasicAuth(p.user, p.password)
+		}
+		if err := pusher.Push(); err != nil {
+			return err
+		}
+	}
+	if p.remoteWriteURL != "" {
+		return p.remoteWrite(mfs)
+	}
+	return nil
+}
+
+// Do sends a push request, adding the bearer token if set.
+func (p *pushTarget) Do(req *http.Request) (*http.Response, error) {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return p.httpClient.Do(req)
+}
+
+func (p *pushTarget) remoteWrite(mfs []*dto.MetricFamily) error {
+	body := snappy.Encode(nil, encodeWriteRequest(mfs, p.job, p.instance, time.Now()))
+	req, err := http.NewRequest("POST", p.remoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.user != "" {
+		req.SetBasicAuth(p.user, p.password)
+	}
+	r, err := p.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(r.Body)
+		return fmt.Errorf("remote write: %s: %s", r.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+type sample struct {
+	labels [][2]string
+	value  float64
+}
+
+// flattenMetricFamilies converts the metric families to samples the way
+// Prometheus does when scraping: summaries and histograms are split into
+// their quantiles or buckets, _sum and _count.
+func flattenMetricFamilies(mfs []*dto.MetricFamily) []sample {
+	var res []sample
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			labels := make([][2]string, 0, len(m.Label)+1)
+			for _, l := range m.Label {
+				labels = append(labels, [2]string{l.GetName(), l.GetValue()})
+			}
+			add := func(suffix string, value float64, extra ...string) {
+				ls := append([][2]string{{"__name__", mf.GetName() + suffix}}, labels...)
+				if len(extra) == 2 {
+					ls = append(ls, [2]string{extra[0], extra[1]})
+				}
+				res = append(res, sample{labels: ls, value: value})
+			}
+			switch {
+			case m.Counter != nil:
+				add("", m.Counter.GetValue())
+			case m.Gauge != nil:
+				add("", m.Gauge.GetValue())
+			case m.Untyped != nil:
+				add("", m.Untyped.GetValue())
+			case m.Summary != nil:
+				for _, q := range m.Summary.Quantile {
+					add("", q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				add("_sum", m.Summary.GetSampleSum())
+				add("_count", float64(m.Summary.GetSampleCount()))
+			case m.Histogram != nil:
+				for _, b := range m.Histogram.Bucket {
+					add("_bucket", float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+				// Histograms parsed from the text format, e.g. of neard,
+				// already have the +Inf bucket.
+				if n := len(m.Histogram.Bucket); n == 0 || !math.IsInf(m.Histogram.Bucket[n-1].GetUpperBound(), 1) {
+					add("_bucket", float64(m.Histogram.GetSampleCount()), "le", "+Inf")
+				}
+				add("_sum", m.Histogram.GetSampleSum())
+				add("_count", float64(m.Histogram.GetSampleCount()))
+			}
+		}
+	}
+	return res
+}
+
+// encodeWriteRequest encodes the samples as a remote write protobuf
+// WriteRequest, with job and instance labels added.
+func encodeWriteRequest(mfs []*dto.MetricFamily, job string, instance string, ts time.Time) []byte {
+	var req []byte
+	for _, s := range flattenMetricFamilies(mfs) {
+		labels := append(s.labels, [2]string{"job", job}, [2]string{"instance", instance})
+		// Remote write requires the labels of a series sorted by name.
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+		var series []byte
+		for _, l := range labels {
+			var label []byte
+			label = appendBytesField(label, 1, []byte(l[0]))
+			label = appendBytesField(label, 2, []byte(l[1]))
+			series = appendBytesField(series, 1, label)
+		}
+		var smpl []byte
+		smpl = append(smpl, 1<<3|1)
+		smpl = appendFixed64(smpl, math.Float64bits(s.value))
+		smpl = append(smpl, 2<<3)
+		smpl = appendUvarint(smpl, uint64(ts.UnixNano()/int64(time.Millisecond)))
+		series = appendBytesField(series, 2, smpl)
+		req = appendBytesField(req, 1, series)
+	}
+	return req
+}
+
+func appendBytesField(b []byte, field int, value []byte) []byte {
+	b = appendUvarint(b, uint64(field)<<3|2)
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
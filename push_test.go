@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// writeSeries is a decoded remote write TimeSeries with a single sample.
+type writeSeries struct {
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a remote write WriteRequest, independently of
+// encodeWriteRequest: message WriteRequest { repeated TimeSeries timeseries = 1; },
+// message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; },
+// message Label { string name = 1; string value = 2; },
+// message Sample { double value = 1; int64 timestamp = 2; }.
+func decodeWriteRequest(t *testing.T, b []byte) []writeSeries {
+	t.Helper()
+	var res []writeSeries
+	for _, series := range decodeFields(t, b, 1) {
+		var s writeSeries
+		samples := 0
+		for _, f := range decodeMessage(t, series) {
+			switch f.num {
+			case 1:
+				var l [2]string
+				for _, lf := range decodeMessage(t, f.bytes) {
+					l[lf.num-1] = string(lf.bytes)
+				}
+				s.labels = append(s.labels, l)
+			case 2:
+				samples++
+				for _, sf := range decodeMessage(t, f.bytes) {
+					switch sf.num {
+					case 1:
+						s.value = math.Float64frombits(sf.fixed64)
+					case 2:
+						s.timestamp = int64(sf.varint)
+					}
+				}
+			default:
+				t.Fatalf("unexpected TimeSeries field %d", f.num)
+			}
+		}
+		if samples != 1 {
+			t.Fatalf("got %d samples in a series, want 1", samples)
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+type field struct {
+	num     int
+	varint  uint64
+	fixed64 uint64
+	bytes   []byte
+}
+
+func decodeMessage(t *testing.T, b []byte) []field {
+	t.Helper()
+	var res []field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("malformed field key in %x", b)
+		}
+		b = b[n:]
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("malformed varint in %x", b)
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 in %x", b)
+			}
+			f.fixed64 = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				t.Fatalf("malformed length in %x", b)
+			}
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// decodeFields decodes a message which only has the length-delimited field num.
+func decodeFields(t *testing.T, b []byte, num int) [][]byte {
+	t.Helper()
+	var res [][]byte
+	for _, f := range decodeMessage(t, b) {
+		if f.num != num {
+			t.Fatalf("unexpected field %d", f.num)
+		}
+		res = append(res, f.bytes)
+	}
+	return res
+}
+
+func TestEncodeWriteRequestGolden(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "a", Help: "A gauge"})
+	gauge.Set(1)
+	reg.MustRegister(gauge)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := encodeWriteRequest(mfs, "j", "i", time.Unix(1, 0))
+
+	label := func(name, value string) []byte {
+		return append([]byte{0x0a, byte(2 + len(name) + 2 + len(value)), 0x0a, byte(len(name))},
+			append(append([]byte(name), 0x12, byte(len(value))), value...)...)
+	}
+	var series []byte
+	series = append(series, label("__name__", "a")...)
+	series = append(series, label("instance", "i")...)
+	series = append(series, label("job", "j")...)
+	// Sample: value 1.0 as a double, timestamp 1000ms as a varint.
+	series = append(series, 0x12, 0x0c, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x10, 0xe8, 0x07)
+	want := append([]byte{0x0a, byte(len(series))}, series...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "near_test_total", Help: "A counter"}, []string{"zone"})
+	counter.WithLabelValues("a").Add(3)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "near_test_height", Help: "A gauge"})
+	gauge.Set(-1.5)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "near_test_seconds", Help: "A histogram", Buckets: []float64{1, 2}})
+	for _, v := range []float64{0.5, 1.5, 5} {
+		histogram.Observe(v)
+	}
+	reg.MustRegister(counter, gauge, histogram)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Unix(1600000000, 123456789)
+	series := decodeWriteRequest(t, encodeWriteRequest(mfs, "near", "host:9333", ts))
+
+	got := map[string]float64{}
+	for _, s := range series {
+		if !sort.SliceIsSorted(s.labels, func(i, j int) bool { return s.labels[i][0] < s.labels[j][0] }) {
+			t.Errorf("labels not sorted by name: %v", s.labels)
+		}
+		if s.timestamp != 1600000000123 {
+			t.Errorf("got timestamp %d, want 1600000000123", s.timestamp)
+		}
+		var name string
+		var rest []string
+		for _, l := range s.labels {
+			if l[0] == "__name__" {
+				name = l[1]
+				continue
+			}
+			rest = append(rest, fmt.Sprintf("%s=%q", l[0], l[1]))
+		}
+		key := name + "{" + strings.Join(rest, ",") + "}"
+		if _, ok := got[key]; ok {
+			t.Errorf("duplicate series %s", key)
+		}
+		got[key] = s.value
+	}
+
+	want := map[string]float64{
+		`near_test_total{instance="host:9333",job="near",zone="a"}`:           3,
+		`near_test_height{instance="host:9333",job="near"}`:                   -1.5,
+		`near_test_seconds_bucket{instance="host:9333",job="near",le="1"}`:    1,
+		`near_test_seconds_bucket{instance="host:9333",job="near",le="2"}`:    2,
+		`near_test_seconds_bucket{instance="host:9333",job="near",le="+Inf"}`: 3,
+		`near_test_seconds_sum{instance="host:9333",job="near"}`:              7,
+		`near_test_seconds_count{instance="host:9333",job="near"}`:            3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got series\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestEncodeWriteRequestParsedHistogram(t *testing.T) {
+	// Histograms parsed from the text format already have the +Inf bucket,
+	// it must not be added twice.
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(`
+# TYPE near_test_seconds histogram
+near_test_seconds_bucket{le="1"} 2
+near_test_seconds_bucket{le="+Inf"} 4
+near_test_seconds_sum 10
+near_test_seconds_count 4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs := []*dto.MetricFamily{families["near_test_seconds"]}
+	var les []string
+	for _, s := range decodeWriteRequest(t, encodeWriteRequest(mfs, "near", "host", time.Unix(0, 0))) {
+		for _, l := range s.labels {
+			if l[0] == "le" {
+				les = append(les, l[1])
+			}
+		}
+	}
+	if want := []string{"1", "+Inf"}; !reflect.DeepEqual(les, want) {
+		t.Errorf("got buckets %v, want %v", les, want)
+	}
+}
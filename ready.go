@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// readiness records whether a collection completed without errors. It is
+// set by the poller, probes only read it.
+type readiness struct {
+	ready int32
+}
+
+func (r *readiness) Set() {
+	atomic.StoreInt32(&r.ready, 1)
+}
+
+func (r *readiness) Ready() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
+
+func readyHandler(r *readiness) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !r.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// nodeReadyHandler responds with 503 unless the last RPC request to the node
+// succeeded, sending a status request if none was sent yet.
+func nodeReadyHandler(client func() *nearapi.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := client()
+		done, err := c.LastRequest()
+		if !done {
+			_, err = c.Get("status", nil)
+		}
+		if err != nil {
+			http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// gateHandler serves the metrics of g, responding with 503 instead until a
+// collection succeeded. Until then every scrape collects once and serves the
+// result only if it has no errors.
+func gateHandler(r *readiness, g prometheus.Gatherer, opts promhttp.HandlerOpts) http.Handler {
+	handler := promhttp.HandlerFor(g, opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.Ready() {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		promhttp.HandlerFor(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil }), opts).ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// alertRule is a Prometheus alerting rule. The near_* metrics its expression
+// uses are checked against the metrics the collectors describe, and the
+// metrics Prometheus adds to every scrape against scrapeMetrics, so that the
+// printed rules can't refer to renamed or removed metrics.
+type alertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+type ruleGroup struct {
+	Name  string      `yaml:"name"`
+	Rules []alertRule `yaml:"rules"`
+}
+
+// alertRuleSpec is an alerting rule before its metrics are checked.
+type alertRuleSpec struct {
+	name     string
+	expr     string
+	duration string
+	severity string
+	summary  string
+}
+
+var alertRules = []alertRuleSpec{
+	{"NearExporterDown", `up{job="near"} == 0`, "5m", "critical", "NEAR exporter {{ $labels.instance }} can't be scraped"},
+	{"NearExporterCollectorFailing", `near_exporter_collector_success == 0`, "15m", "warning", "Collector {{ $labels.collector }} of {{ $labels.instance }} fails"},
+	{"NearNodeNotSyncing", `delta(near_block_number[5m]) == 0`, "5m", "critical", "Node {{ $labels.instance }} received no new blocks for 5 minutes"},
+	{"NearNodeCatchingUp", `near_sync_state == 1`, "15m", "warning", "Node {{ $labels.instance }} is syncing"},
+	{"NearBlockLag", `near_block_lag > 50`, "5m", "warning", "Node {{ $labels.instance }} is {{ $value }} blocks behind the reference node"},
+	{"NearKickoutRisk", `near_account_kickout_risk < 0.05`, "10m", "critical", "Productivity of {{ $labels.instance }} is close to the kickout threshold"},
+	{"NearStakeDrop", `(near_account_next_validator_stake - near_account_current_validator_stake) / near_account_current_validator_stake < -0.1`, "", "warning", "Stake of {{ $labels.instance }} for the next epoch dropped by more than 10%"},
+	{"NearDelegatorWithdrawal", `increase(near_account_delegator_withdrawals_total[1h]) > 0.05 * sum without(epoch) (near_account_delegated_stake_total)`, "", "warning", "Delegators withdrew more than 5% of the stake of {{ $labels.instance }} within an hour"},
+}
+
+// scrapeMetrics are the metrics Prometheus adds to every scrape, by name.
+var scrapeMetrics = map[string]string{
+	"up": "Whether Prometheus scraped the exporter successfully, 0 when the exporter is down, unreachable or its scrape failed",
+}
+
+var metricNamePattern = regexp.MustCompile(`\b(near_[a-z0-9_]+|up)\b`)
+
+// maxDescLabels bounds the number of variable labels descMetric tries.
+const maxDescLabels = 10
+
+// descMetric collects a zero sample of desc, so that its name and help can be
+// read from the gathered metric family. Desc has no accessors and the format
+// of its String method is not part of the API.
+type descMetric struct {
+	desc *prometheus.Desc
+}
+
+func (c descMetric) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c descMetric) Collect(ch chan<- prometheus.Metric) {
+	for n := 0; n <= maxDescLabels; n++ {
+		if m, err := prometheus.NewConstMetric(c.desc, prometheus.UntypedValue, 0, make([]string, n)...); err == nil {
+			ch <- m
+			return
+		}
+	}
+}
+
+// describedMetrics returns the help of every metric the collectors describe
+// by name.
+func describedMetrics() (map[string]string, error) {
+	settings := collector.Settings{RawYocto: true}
+	collectors := []prometheus.Collector{
+		newCollectorStats(""),
+		newWatchdog(0, false),
+		nearapi.NewMetrics(),
+		collector.NewCacheMetrics(),
+		collector.NewNodeRpcMetrics(nil, true, false, true),
+		collector.NewNetworkMetrics(nil),
+		collector.NewBlockMetrics(nil, "", 2),
+		collector.NewReferenceMetrics(nil, nil),
+		collector.NewValidatorMetrics(nil, "", "", true, true, nil, settings),
+		collector.NewStakingPoolMetrics(nil, "", "", settings),
+		collector.NewValidatorKeyMetrics(nil, nil, "", ""),
+		collector.NewRewardMetrics(nil, "", "", settings),
+		collector.NewProtocolMetrics(nil, ""),
+		collector.NewEpochMetrics(nil, ""),
+		collector.NewDelegatorMetrics(nil, "", nil, "", settings),
+		collector.NewAccountBalanceMetrics(nil, nil, "", settings),
+		collector.NewAllPoolsMetrics(nil, "", 1, 0, settings),
+	}
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		for _, c := range collectors {
+			c.Describe(ch)
+		}
+		close(ch)
+	}()
+	var descs []*prometheus.Desc
+	for desc := range ch {
+		descs = append(descs, desc)
+	}
+
+	res := make(map[string]string)
+	for _, desc := range descs {
+		r := prometheus.NewRegistry()
+		if err := r.Register(descMetric{desc}); err != nil {
+			return nil, err
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			return nil, err
+		}
+		if len(mfs) != 1 {
+			return nil, fmt.Errorf("no metric of %s", desc)
+		}
+		res[mfs[0].GetName()] = mfs[0].GetHelp()
+	}
+	return res, nil
+}
+
+// printRules writes the alerting rules as a Prometheus rules file. The help
+// of the first metric of a rule becomes its description.
+func printRules(w io.Writer) error {
+	metrics, err := describedMetrics()
+	if err != nil {
+		return err
+	}
+	for name, help := range scrapeMetrics {
+		metrics[name] = help
+	}
+	group := ruleGroup{Name: "near"}
+	for _, r := range alertRules {
+		names := metricNamePattern.FindAllString(r.expr, -1)
+		if len(names) == 0 {
+			return fmt.Errorf("rule %s uses no metric", r.name)
+		}
+		for _, name := range names {
+			if _, ok := metrics[name]; !ok {
+				return fmt.Errorf("rule %s: unknown metric %s", r.name, name)
+			}
+		}
+		group.Rules = append(group.Rules, alertRule{
+			Alert:  r.name,
+			Expr:   r.expr,
+			For:    r.duration,
+			Labels: map[string]string{"severity": r.severity},
+			Annotations: map[string]string{
+				"summary":     r.summary,
+				"description": metrics[names[0]],
+			},
+		})
+	}
+	b, err := yaml.Marshal(map[string][]ruleGroup{"groups": {group}})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
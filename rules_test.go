@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestDescribedMetrics(t *testing.T) {
+	metrics, err := describedMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"near_exporter_build_info",
+		"near_exporter_collector_stuck",
+		"near_exporter_rpc_requests_total",
+		"near_exporter_cached_response_age_seconds",
+		"near_block_number",
+		"near_account_current_validator_stake_yocto",
+		"near_delegator_staked_balance",
+		"near_account_storage_usage",
+		"near_pool_delegated_stake",
+	} {
+		if metrics[name] == "" {
+			t.Errorf("%s is not described", name)
+		}
+	}
+}
+
+func TestPrintRules(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printRules(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var rules map[string][]ruleGroup
+	if err := yaml.UnmarshalStrict(buf.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules["groups"]) != 1 || len(rules["groups"][0].Rules) != len(alertRules) {
+		t.Fatalf("got %+v, want one group of %d rules", rules, len(alertRules))
+	}
+	for _, r := range rules["groups"][0].Rules {
+		if r.Expr == "" || r.Labels["severity"] == "" || r.Annotations["description"] == "" {
+			t.Errorf("incomplete rule %+v", r)
+		}
+		// The exporter can't report that it is down, only the scrape can.
+		if r.Alert == "NearExporterDown" && (r.Expr != `up{job="near"} == 0` || r.Annotations["description"] != scrapeMetrics["up"]) {
+			t.Errorf("got %+v, want the up metric of the scrape", r)
+		}
+	}
+}
+
+func TestPrintRulesUnknownMetric(t *testing.T) {
+	defer func(rules []alertRuleSpec) { alertRules = rules }(alertRules)
+	alertRules = append(alertRules[:len(alertRules):len(alertRules)], alertRuleSpec{name: "NearRenamed", expr: "near_renamed_metric > 0", severity: "warning"})
+	err := printRules(&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "near_renamed_metric") {
+		t.Fatalf("got error %v, want the unknown metric", err)
+	}
+}
+
+func TestMetricNamePattern(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: `up{job="near"} == 0`, want: []string{"up"}},
+		{expr: `near_block_lag > 50`, want: []string{"near_block_lag"}},
+		{expr: `rate(near_exporter_rpc_errors_total[5m]) / on(instance) group_left up`, want: []string{"near_exporter_rpc_errors_total", "up"}},
+		{expr: `node_uptime_seconds < 60`, want: nil},
+	}
+	for _, tt := range tests {
+		if got := metricNamePattern.FindAllString(tt.expr, -1); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got metrics %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const envPrefix = "NEAR_EXPORTER_"
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+}
+
+// applyEnv sets every flag not in set from the environment and adds it to
+// set. NEAR_EXPORTER_<FLAG> holds the value itself and
+// NEAR_EXPORTER_<FLAG>_FILE the path of a file containing it, e.g. a Docker
+// or Kubernetes secret. Values of secret flags of the form
+// vault:<path>#<key> are looked up in HashiCorp Vault.
+func applyEnv(fs *flag.FlagSet, set map[string]bool) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		value := f.Value.String()
+		if name := canonicalFlag(f.Name); !set[name] {
+			env := envName(f.Name)
+			if v, ok := os.LookupEnv(env); ok {
+				value = v
+				set[name] = true
+			} else if path, ok := os.LookupEnv(env + "_FILE"); ok {
+				set[name] = true
+				data, rerr := ioutil.ReadFile(path)
+				if rerr != nil {
+					err = fmt.Errorf("%s_FILE: %v", env, rerr)
+					return
+				}
+				value = strings.TrimRight(string(data), "\r\n")
+			}
+		}
+		if isSecretFlag(f.Name) && strings.HasPrefix(value, "vault:") {
+			if value, err = vaultLookup(strings.TrimPrefix(value, "vault:")); err != nil {
+				err = fmt.Errorf("-%s: %v", f.Name, err)
+				return
+			}
+		}
+		if value != f.Value.String() {
+			if serr := fs.Set(f.Name, value); serr != nil {
+				err = fmt.Errorf("-%s: %v", f.Name, serr)
+			}
+		}
+	})
+	return err
+}
+
+// vaultLookup reads a key of a Vault secret, ref is <path>#<key>, e.g.
+// secret/data/near#rpc-token. The server and token are taken from the
+// standard VAULT_ADDR and VAULT_TOKEN environment variables. Both KV version
+// 1 and 2 secrets are supported.
+func vaultLookup(ref string) (string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i < 0 {
+		return "", fmt.Errorf("vault reference %q has no #key", ref)
+	}
+	path, key := ref[:i], ref[i+1:]
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	r, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: unexpected status %s", r.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault: key %q not found in %s", key, path)
+	}
+	return value, nil
+}
+
+// headerFlag collects HTTP headers of the form "Name: value", the flag may be
+// repeated and a value may hold several headers on separate lines. An empty
+// value removes all headers.
+type headerFlag struct {
+	header http.Header
+}
+
+func (f *headerFlag) String() string {
+	if f == nil || f.header == nil {
+		return ""
+	}
+	var lines []string
+	for k, vs := range f.header {
+		for _, v := range vs {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (f *headerFlag) Set(value string) error {
+	if value == "" {
+		f.header = nil
+		return nil
+	}
+	if f.header == nil {
+		f.header = make(http.Header)
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return fmt.Errorf("header %q is not of the form Name: value", line)
+		}
+		f.header.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	}
+	return nil
+}
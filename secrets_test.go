@@ -0,0 +1,190 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestVault serves a KV version 1 secret at secret/near and a version 2
+// secret at secret/data/near, for the token "root".
+func newTestVault() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/near":
+			w.Write([]byte(`{"data":{"rpc-token":"v1-token"}}`))
+		case "/v1/secret/data/near":
+			w.Write([]byte(`{"data":{"data":{"rpc-token":"v2-token"},"metadata":{"version":3}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestApplyEnvSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(secretFile, []byte("file-token\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vault := newTestVault()
+	defer vault.Close()
+	defer setEnv(t, "VAULT_ADDR", vault.URL+"/")()
+	defer setEnv(t, "VAULT_TOKEN", "root")()
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "value",
+			env:  map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "env-token"},
+			want: "env-token",
+		},
+		{
+			name: "file",
+			env:  map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN_FILE": secretFile},
+			want: "file-token",
+		},
+		{
+			name: "value wins over file",
+			env:  map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "env-token", "NEAR_EXPORTER_RPC_BEARER_TOKEN_FILE": secretFile},
+			want: "env-token",
+		},
+		{
+			name: "command line wins",
+			env:  map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN_FILE": secretFile},
+			args: []string{"-rpc-bearer-token", "cli-token"},
+			want: "cli-token",
+		},
+		{
+			name:    "missing file",
+			env:     map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN_FILE": filepath.Join(dir, "missing")},
+			wantErr: "NEAR_EXPORTER_RPC_BEARER_TOKEN_FILE: open",
+		},
+		{
+			name: "vault KV version 1",
+			env:  map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "vault:secret/near#rpc-token"},
+			want: "v1-token",
+		},
+		{
+			name: "vault KV version 2",
+			env:  map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "vault:secret/data/near#rpc-token"},
+			want: "v2-token",
+		},
+		{
+			name: "vault on the command line",
+			args: []string{"-rpc-bearer-token", "vault:secret/near#rpc-token"},
+			want: "v1-token",
+		},
+		{
+			name:    "vault missing key",
+			env:     map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "vault:secret/near#other"},
+			wantErr: `key "other" not found`,
+		},
+		{
+			name:    "vault missing secret",
+			env:     map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "vault:secret/other#rpc-token"},
+			wantErr: "404 Not Found",
+		},
+		{
+			name:    "vault reference without key",
+			env:     map[string]string{"NEAR_EXPORTER_RPC_BEARER_TOKEN": "vault:secret/near"},
+			wantErr: "has no #key",
+		},
+		{
+			// Only secret flags are looked up in Vault.
+			name: "not a secret flag",
+			env:  map[string]string{"NEAR_EXPORTER_COLLECTORS": "vault:secret/near#rpc-token"},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				defer setEnv(t, key, value)()
+			}
+			fs, _ := newTestFlagSet(t, tt.args...)
+			err := applyEnv(fs, cliFlags(fs))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := flagValue(fs, "rpc-bearer-token"); got != tt.want {
+				t.Errorf("got token %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigVault(t *testing.T) {
+	vault := newTestVault()
+	defer vault.Close()
+	defer setEnv(t, "VAULT_ADDR", vault.URL)()
+	defer setEnv(t, "VAULT_TOKEN", "root")()
+
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("rpc:\n  bearer_token: vault:secret/data/near#rpc-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, configFile := newTestFlagSet(t, "-config.file", path)
+	cli := cliFlags(fs)
+	if err := loadConfig(fs, cli, configFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := flagValue(fs, "rpc-bearer-token"); got != "v2-token" {
+		t.Errorf("got token %q, want %q", got, "v2-token")
+	}
+
+	defer setEnv(t, "VAULT_TOKEN", "wrong")()
+	err = loadConfig(fs, cli, configFile)
+	if err == nil || !strings.Contains(err.Error(), "rpc-bearer-token: vault: unexpected status 403") {
+		t.Fatalf("got error %v, want the Vault status", err)
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	var f headerFlag
+	for _, value := range []string{"X-Api-Key: key", "X-Org: a\n\nX-Org:b "} {
+		if err := f.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := f.header["X-Api-Key"]; len(got) != 1 || got[0] != "key" {
+		t.Errorf("got X-Api-Key %v", got)
+	}
+	if got := f.header["X-Org"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got X-Org %v", got)
+	}
+	if err := f.Set("no colon"); err == nil {
+		t.Error("want an error for a header without a colon")
+	}
+	if err := f.Set(""); err != nil || f.String() != "" {
+		t.Errorf("an empty value must remove the headers, got %q, %v", f.String(), err)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Target is a scrape target managed through the admin API or discovered from
+// file_sd files. Timeout and PollInterval are Go duration strings, zero
+// values keep the defaults, the RPC flags for Timeout and Retries. Labels are attached to all metrics of the target.
+type Target struct {
+	Name           string            `json:"name"`
+	URL            string            `json:"url"`
+	AccountId      string            `json:"account_id"`
+	Timeout        string            `json:"timeout,omitempty"`
+	Retries        int               `json:"retries,omitempty"`
+	MaxConcurrency int               `json:"max_concurrency,omitempty"`
+	PollInterval   string            `json:"poll_interval,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	// Source is empty for targets added through the admin API, only those
+	// are persisted.
+	Source string `json:"source,omitempty"`
+}
+
+type targetEntry struct {
+	Target
+	gatherer prometheus.Gatherer
+}
+
+type registryBuilder func(t Target, client *nearapi.Client) prometheus.Gatherer
+
+// targetStore holds the scrape targets managed at runtime through the admin
+// API. When path is set the targets are persisted to that file. The clients
+// of the targets are created by newClient, the options of a target override
+// its defaults. Poll intervals are capped at maxAge, if set.
+type targetStore struct {
+	path      string
+	newClient func(endpoint string) *nearapi.Client
+	build     registryBuilder
+	maxAge    time.Duration
+
+	mu      sync.RWMutex
+	targets map[string]*targetEntry
+}
+
+func newTargetStore(path string, newClient func(endpoint string) *nearapi.Client, build registryBuilder, maxAge time.Duration) (*targetStore, error) {
+	s := &targetStore{
+		path:      path,
+		newClient: newClient,
+		build:     build,
+		maxAge:    maxAge,
+		targets:   make(map[string]*targetEntry),
+	}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		e, err := s.newEntry(t)
+		if err != nil {
+			return nil, err
+		}
+		s.targets[t.Name] = e
+	}
+	return s, nil
+}
+
+func (s *targetStore) newEntry(t Target) (*targetEntry, error) {
+	if t.Name == "" || t.URL == "" {
+		return nil, errors.New("name and url are required")
+	}
+	var timeout time.Duration
+	if t.Timeout != "" {
+		d, err := time.ParseDuration(t.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		timeout = d
+	}
+	var pollInterval time.Duration
+	if t.PollInterval != "" {
+		d, err := time.ParseDuration(t.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		pollInterval = d
+	}
+	if s.maxAge > 0 && pollInterval > s.maxAge {
+		pollInterval = s.maxAge
+	}
+
+	client := s.newClient(t.URL)
+	if timeout > 0 {
+		client.SetTimeout(timeout)
+	}
+	if t.Retries > 0 {
+		client.Retries = t.Retries
+	}
+	client.SetMaxConcurrency(t.MaxConcurrency)
+	return &targetEntry{
+		Target:   t,
+		gatherer: &cachedGatherer{Gatherer: s.build(t, client), interval: pollInterval},
+	}, nil
+}
+
+func (s *targetStore) Get(name string) (prometheus.Gatherer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.targets[name]
+	if !ok {
+		return nil, false
+	}
+	return e.gatherer, true
+}
+
+func (s *targetStore) List() []Target {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list()
+}
+
+func (s *targetStore) list() []Target {
+	res := make([]Target, 0, len(s.targets))
+	for _, e := range s.targets {
+		res = append(res, e.Target)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func (s *targetStore) Add(t Target) error {
+	e, err := s.newEntry(t)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[t.Name] = e
+	return s.save()
+}
+
+func (s *targetStore) Remove(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.targets[name]; !ok {
+		return false, nil
+	}
+	delete(s.targets, name)
+	return true, s.save()
+}
+
+// ReplaceSource replaces all targets of the given source. Unchanged targets
+// keep their cached metrics.
+func (s *targetStore) ReplaceSource(source string, targets []Target) error {
+	entries := make(map[string]*targetEntry)
+	s.mu.RLock()
+	for _, t := range targets {
+		t.Source = source
+		if e, ok := s.targets[t.Name]; ok && reflect.DeepEqual(e.Target, t) {
+			entries[t.Name] = e
+		}
+	}
+	s.mu.RUnlock()
+	for _, t := range targets {
+		t.Source = source
+		if _, ok := entries[t.Name]; ok {
+			continue
+		}
+		e, err := s.newEntry(t)
+		if err != nil {
+			return fmt.Errorf("target %s: %v", t.Name, err)
+		}
+		entries[t.Name] = e
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, e := range s.targets {
+		if e.Source == source {
+			delete(s.targets, name)
+		}
+	}
+	for name, e := range entries {
+		s.targets[name] = e
+	}
+	return nil
+}
+
+func (s *targetStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	var targets []Target
+	for _, t := range s.list() {
+		if t.Source == "" {
+			targets = append(targets, t)
+		}
+	}
+	data, err := json.MarshalIndent(targets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// cachedGatherer reuses the gathered metrics for interval, so that a target
+// is polled at most once per interval regardless of the scrape frequency.
+type cachedGatherer struct {
+	prometheus.Gatherer
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+	mfs  []*dto.MetricFamily
+	err  error
+}
+
+func (g *cachedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	if g.interval <= 0 {
+		return g.Gatherer.Gather()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.last.IsZero() || time.Since(g.last) >= g.interval {
+		g.mfs, g.err = g.Gatherer.Gather()
+		g.last = time.Now()
+	}
+	return g.mfs, g.err
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// targetsHandler serves the admin API:
+//
+//	GET    /api/v1/targets         list targets
+//	POST   /api/v1/targets         add or replace a target
+//	DELETE /api/v1/targets/<name>  remove a target
+func targetsHandler(store *targetStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/targets"), "/")
+		switch {
+		case r.Method == http.MethodGet && name == "":
+			writeJSON(w, http.StatusOK, store.List())
+		case r.Method == http.MethodPost && name == "":
+			var t Target
+			if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			t.Source = ""
+			if err := store.Add(t); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusCreated, t)
+		case r.Method == http.MethodDelete && name != "":
+			ok, err := store.Remove(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logging.Error("writing response failed", "err", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	nearapi "github.com/madnadyka/near-prometheus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTargetClients(t *testing.T) {
+	config := clientConfig{
+		timeout:     5 * time.Second,
+		retries:     1,
+		backoff:     250 * time.Millisecond,
+		header:      http.Header{"X-Api-Key": []string{"secret"}},
+		bearerToken: "token",
+		metrics:     nearapi.NewMetrics(),
+	}
+	clients := make(map[string]*nearapi.Client)
+	store, err := newTargetStore("", config.newClient, func(t Target, c *nearapi.Client) prometheus.Gatherer {
+		clients[t.Name] = c
+		return prometheus.NewRegistry()
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(Target{Name: "defaults", URL: "http://node1:3030"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(Target{Name: "overrides", URL: "http://node2:3030", Retries: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, wantRetries := range map[string]int{"defaults": 1, "overrides": 3} {
+		c := clients[name]
+		if c.Retries != wantRetries || c.Backoff != config.backoff {
+			t.Errorf("%s: got retries %d and backoff %v, want %d and %v", name, c.Retries, c.Backoff, wantRetries, config.backoff)
+		}
+		if c.Header.Get("X-Api-Key") != "secret" || c.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("%s: got headers %v", name, c.Header)
+		}
+		if c.Metrics != config.metrics {
+			t.Errorf("%s: the RPC metrics are not recorded", name)
+		}
+	}
+	if clients["overrides"].Endpoint != "http://node2:3030" {
+		t.Errorf("got endpoint %s", clients["overrides"].Endpoint)
+	}
+}
+
+func TestTargetsAdminAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.json")
+
+	store, err := newTargetStore(path, nearapi.NewClient, func(Target, *nearapi.Client) prometheus.Gatherer { return prometheus.NewRegistry() }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ReplaceSource("file_sd", []Target{{Name: "discovered", URL: "http://node3:3030"}}); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/targets", requireToken("secret", targetsHandler(store)))
+	mux.Handle("/api/v1/targets/", requireToken("secret", targetsHandler(store)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, token, body string) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.StatusCode, string(data)
+	}
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{name: "no token", method: "GET", path: "/api/v1/targets", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", method: "GET", path: "/api/v1/targets", token: "wrong", wantCode: http.StatusUnauthorized},
+		{name: "unauthorized add", method: "POST", path: "/api/v1/targets", token: "wrong", body: `{"name":"node1","url":"http://node1:3030"}`, wantCode: http.StatusUnauthorized},
+		{name: "add", method: "POST", path: "/api/v1/targets", token: "secret", body: `{"name":"node1","url":"http://node1:3030","account_id":"pool.test","source":"file_sd"}`, wantCode: http.StatusCreated},
+		{name: "add another", method: "POST", path: "/api/v1/targets", token: "secret", body: `{"name":"node2","url":"http://node2:3030","poll_interval":"30s"}`, wantCode: http.StatusCreated},
+		{name: "missing url", method: "POST", path: "/api/v1/targets", token: "secret", body: `{"name":"node4"}`, wantCode: http.StatusBadRequest},
+		{name: "invalid timeout", method: "POST", path: "/api/v1/targets", token: "secret", body: `{"name":"node4","url":"http://node4:3030","timeout":"soon"}`, wantCode: http.StatusBadRequest},
+		{name: "malformed body", method: "POST", path: "/api/v1/targets", token: "secret", body: `{"name":`, wantCode: http.StatusBadRequest},
+		{name: "remove", method: "DELETE", path: "/api/v1/targets/node2", token: "secret", wantCode: http.StatusNoContent},
+		{name: "remove missing", method: "DELETE", path: "/api/v1/targets/node2", token: "secret", wantCode: http.StatusNotFound},
+		{name: "remove without name", method: "DELETE", path: "/api/v1/targets", token: "secret", wantCode: http.StatusMethodNotAllowed},
+		{name: "unsupported method", method: "PUT", path: "/api/v1/targets", token: "secret", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, s := range steps {
+		if code, body := do(s.method, s.path, s.token, s.body); code != s.wantCode {
+			t.Fatalf("%s: got status %d (%s), want %d", s.name, code, strings.TrimSpace(body), s.wantCode)
+		}
+	}
+	for _, name := range []string{"node1", "discovered"} {
+		if _, ok := store.Get(name); !ok {
+			t.Errorf("target %s is not served", name)
+		}
+	}
+	if _, ok := store.Get("node2"); ok {
+		t.Error("the removed target is still served")
+	}
+
+	// Targets added through the API lose their source, the discovered
+	// ones are listed but not persisted.
+	code, body := do("GET", "/api/v1/targets", "secret", "")
+	if code != http.StatusOK {
+		t.Fatalf("list: got status %d", code)
+	}
+	var listed []Target
+	if err := json.Unmarshal([]byte(body), &listed); err != nil {
+		t.Fatal(err)
+	}
+	want := []Target{
+		{Name: "discovered", URL: "http://node3:3030", Source: "file_sd"},
+		{Name: "node1", URL: "http://node1:3030", AccountId: "pool.test"},
+	}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("got targets %+v, want %+v", listed, want)
+	}
+
+	reloaded, err := newTargetStore(path, nearapi.NewClient, func(Target, *nearapi.Client) prometheus.Gatherer { return prometheus.NewRegistry() }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.List(); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("got persisted targets %+v, want %+v", got, want[1:])
+	}
+}
@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Scope records the gatherings of a registry as traces, with the
+// collections of its collectors as child spans. Prometheus collectors can't
+// take the context of a gathering, so the collectors wrapped by the scope
+// find the span of the gathering in progress in the scope, and gatherings
+// are serialized. A nil *Scope records nothing.
+type Scope struct {
+	tracer *Tracer
+
+	gathering sync.Mutex
+	mu        sync.RWMutex
+	span      *Span
+}
+
+// NewScope returns a scope recording to t, nil if t is nil.
+func NewScope(t *Tracer) *Scope {
+	if t == nil {
+		return nil
+	}
+	return &Scope{tracer: t}
+}
+
+type tracedGatherer struct {
+	prometheus.Gatherer
+	scope *Scope
+}
+
+// WrapGatherer records every gathering of g as a trace, g should gather
+// collectors wrapped by WrapCollector of the same scope.
+func (s *Scope) WrapGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if s == nil {
+		return g
+	}
+	return &tracedGatherer{Gatherer: g, scope: s}
+}
+
+func (g *tracedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	s := g.scope
+	s.gathering.Lock()
+	defer s.gathering.Unlock()
+	span := s.tracer.StartRoot("collect")
+	s.mu.Lock()
+	s.span = span
+	s.mu.Unlock()
+
+	mfs, err := g.Gatherer.Gather()
+
+	s.mu.Lock()
+	s.span = nil
+	s.mu.Unlock()
+	span.End(err)
+	return mfs, err
+}
+
+// WrapCollector records every collection of c as a child span of the
+// gathering in progress, or as a trace of its own outside of a gathering.
+func (s *Scope) WrapCollector(name string, c prometheus.Collector) prometheus.Collector {
+	if s == nil {
+		return c
+	}
+	return &tracedCollector{Collector: c, tracer: s.tracer, name: name, scope: s}
+}
+
+func (s *Scope) context() context.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ContextWithSpan(context.Background(), s.span)
+}
+
+type tracedCollector struct {
+	prometheus.Collector
+	tracer *Tracer
+	name   string
+	scope  *Scope
+}
+
+type contextCollector interface {
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// WrapCollector records a trace for every collection of c, use a Scope to
+// record the collections as part of the gatherings instead. If c has a
+// CollectContext method, the spans c starts from its context, e.g. of RPC
+// calls, are children of the collection span.
+func WrapCollector(t *Tracer, name string, c prometheus.Collector) prometheus.Collector {
+	if t == nil {
+		return c
+	}
+	return &tracedCollector{Collector: c, tracer: t, name: name}
+}
+
+var errInvalidMetric = errors.New("collector returned invalid metrics")
+
+func (c *tracedCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	if c.scope != nil {
+		ctx = c.scope.context()
+	}
+	c.CollectContext(ctx, ch)
+}
+
+func (c *tracedCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	span, ctx := c.tracer.Start(ctx, "collect "+c.name)
+	span.SetAttribute("collector", c.name)
+
+	inner := make(chan prometheus.Metric)
+	done := make(chan error)
+	go func() {
+		var err error
+		for m := range inner {
+			if err == nil {
+				if werr := m.Write(&dto.Metric{}); werr != nil {
+					err = errInvalidMetric
+				}
+			}
+			ch <- m
+		}
+		done <- err
+	}()
+	if cc, ok := c.Collector.(contextCollector); ok {
+		cc.CollectContext(ctx, inner)
+	} else {
+		c.Collector.Collect(inner)
+	}
+	close(inner)
+	span.End(<-done)
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var testDesc = prometheus.NewDesc("near_test", "A test metric", nil, nil)
+
+// rpcCollector starts a span for an RPC call from the context of its
+// collection.
+type rpcCollector struct {
+	tracer *Tracer
+}
+
+func (c *rpcCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testDesc
+}
+
+func (c *rpcCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(context.Background(), ch)
+}
+
+func (c *rpcCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	span, _ := c.tracer.Start(ctx, "rpc status")
+	span.End(nil)
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 1)
+}
+
+func TestScopeGatheringTrace(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	tracer := NewTracer(srv.URL, "near-exporter")
+
+	scope := NewScope(tracer)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(scope.WrapCollector("node", &rpcCollector{tracer: tracer}))
+	gatherer := scope.WrapGatherer(registry)
+
+	const gatherings = 4
+	var wg sync.WaitGroup
+	for i := 0; i < gatherings; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := gatherer.Gather(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every gathering is one trace: collect -> collect node -> rpc status.
+	traces := make(map[string]map[string]otlpSpan)
+	for _, s := range c.requests[0].ResourceSpans[0].ScopeSpans[0].Spans {
+		if traces[s.TraceId] == nil {
+			traces[s.TraceId] = make(map[string]otlpSpan)
+		}
+		if _, ok := traces[s.TraceId][s.Name]; ok {
+			t.Errorf("trace %s has several %q spans", s.TraceId, s.Name)
+		}
+		traces[s.TraceId][s.Name] = s
+	}
+	if len(traces) != gatherings {
+		t.Fatalf("got %d traces, want %d", len(traces), gatherings)
+	}
+	for id, spans := range traces {
+		root, collection, call := spans["collect"], spans["collect node"], spans["rpc status"]
+		if len(spans) != 3 || root.ParentSpanId != "" || collection.ParentSpanId != root.SpanId || call.ParentSpanId != collection.SpanId {
+			t.Errorf("trace %s: got spans %+v", id, spans)
+		}
+	}
+}
+
+func TestScopeOutsideGathering(t *testing.T) {
+	tracer := NewTracer("http://localhost:4318", "near-exporter")
+	scope := NewScope(tracer)
+	c := scope.WrapCollector("node", &rpcCollector{tracer: tracer})
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(tracer.spans))
+	}
+	call, collection := tracer.spans[0], tracer.spans[1]
+	if collection.parentId != "" || call.parentId != collection.spanId {
+		t.Errorf("a collection outside of a gathering must be a trace of its own, got %+v and %+v", collection, call)
+	}
+}
+
+func TestNilScope(t *testing.T) {
+	scope := NewScope(nil)
+	c := &rpcCollector{}
+	if scope.WrapCollector("node", c) != prometheus.Collector(c) {
+		t.Error("a nil scope must not wrap collectors")
+	}
+	registry := prometheus.NewRegistry()
+	if scope.WrapGatherer(registry) != prometheus.Gatherer(registry) {
+		t.Error("a nil scope must not wrap gatherers")
+	}
+}
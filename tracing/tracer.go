@@ -0,0 +1,240 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+)
+
+const maxQueuedSpans = 4096
+
+// Tracer records spans and exports them in batches to an OTLP/HTTP
+// collector using the JSON encoding. A nil *Tracer is valid and records
+// nothing, so callers don't need to check whether tracing is enabled.
+type Tracer struct {
+	endpoint   string
+	service    string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+type Span struct {
+	tracer   *Tracer
+	traceId  string
+	spanId   string
+	parentId string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	err      error
+}
+
+// NewTracer creates a tracer exporting to the OTLP/HTTP endpoint, e.g.
+// http://localhost:4318.
+func NewTracer(endpoint string, service string) *Tracer {
+	return &Tracer{
+		endpoint:   strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service:    service,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func randomId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s as parent of the spans
+// started with it.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span ctx carries, nil if none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// StartRoot starts a new trace, e.g. for a collection cycle.
+func (t *Tracer) StartRoot(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	return &Span{
+		tracer:  t,
+		traceId: randomId(16),
+		spanId:  randomId(8),
+		name:    name,
+		start:   time.Now(),
+		attrs:   make(map[string]string),
+	}
+}
+
+// Start starts a child span of the span ctx carries, or a new trace when it
+// carries none. The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string) (*Span, context.Context) {
+	if t == nil {
+		return nil, ctx
+	}
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		s := t.StartRoot(name)
+		return s, ContextWithSpan(ctx, s)
+	}
+	s := &Span{
+		tracer:   t,
+		traceId:  parent.traceId,
+		spanId:   randomId(8),
+		parentId: parent.spanId,
+		name:     name,
+		start:    time.Now(),
+		attrs:    make(map[string]string),
+	}
+	return s, ContextWithSpan(ctx, s)
+}
+
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// End finishes the span, a non-nil err marks it as failed.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) < maxQueuedSpans {
+		t.spans = append(t.spans, s)
+	}
+}
+
+// Run exports the recorded spans every interval. It never returns.
+func (t *Tracer) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := t.Flush(); err != nil {
+			logging.Warn("exporting spans failed", "err", err)
+		}
+	}
+}
+
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return err
+	}
+	r, err := t.httpClient.Post(t.endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: unexpected status %s", r.Status)
+	}
+	return nil
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceId           string     `json:"traceId"`
+	SpanId            string     `json:"spanId"`
+	ParentSpanId      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func attribute(key string, value string) keyValue {
+	kv := keyValue{Key: key}
+	kv.Value.StringValue = value
+	return kv
+}
+
+func (t *Tracer) encode(spans []*Span) interface{} {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceId:           s.traceId,
+			SpanId:            s.spanId,
+			ParentSpanId:      s.parentId,
+			Name:              s.name,
+			Kind:              1,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for k, v := range s.attrs {
+			o.Attributes = append(o.Attributes, attribute(k, v))
+		}
+		if s.err != nil {
+			o.Status.Code = 2
+			o.Status.Message = s.err.Error()
+		}
+		out = append(out, o)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []keyValue{attribute("service.name", t.service)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": t.service},
+						"spans": out,
+					},
+				},
+			},
+		},
+	}
+}
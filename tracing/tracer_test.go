@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is an OTLP/HTTP collector recording the exported requests.
+type collector struct {
+	mu       sync.Mutex
+	status   int
+	requests []exportRequest
+}
+
+type exportRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	var req exportRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.requests = append(c.requests, req)
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	tracer := NewTracer(srv.URL+"/", "near-exporter")
+
+	before := time.Now()
+	root := tracer.StartRoot("collect")
+	ctx := ContextWithSpan(context.Background(), root)
+	child, childCtx := tracer.Start(ctx, "rpc status")
+	child.SetAttribute("rpc.method", "status")
+	grandchild, _ := tracer.Start(childCtx, "decode")
+	grandchild.End(nil)
+	child.End(errors.New("status: 502 Bad Gateway"))
+	root.End(nil)
+	other, _ := tracer.Start(context.Background(), "unrelated")
+	other.End(nil)
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is left to export.
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.requests) != 1 {
+		t.Fatalf("got %d export requests, want 1", len(c.requests))
+	}
+	req := c.requests[0]
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got %+v, want one resource and scope", req)
+	}
+	rs := req.ResourceSpans[0]
+	if attrs := rs.Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" || attrs[0].Value.StringValue != "near-exporter" {
+		t.Errorf("got resource attributes %+v", attrs)
+	}
+	if name := rs.ScopeSpans[0].Scope.Name; name != "near-exporter" {
+		t.Errorf("got scope %q", name)
+	}
+
+	spans := make(map[string]otlpSpan)
+	for _, s := range rs.ScopeSpans[0].Spans {
+		spans[s.Name] = s
+		if len(s.TraceId) != 32 || len(s.SpanId) != 16 {
+			t.Errorf("%s: got trace id %q and span id %q, want 16 and 8 hex bytes", s.Name, s.TraceId, s.SpanId)
+		}
+		start, err1 := strconv.ParseInt(s.StartTimeUnixNano, 10, 64)
+		end, err2 := strconv.ParseInt(s.EndTimeUnixNano, 10, 64)
+		if err1 != nil || err2 != nil || start < before.UnixNano() || end < start {
+			t.Errorf("%s: got start %s and end %s", s.Name, s.StartTimeUnixNano, s.EndTimeUnixNano)
+		}
+		if s.Kind != 1 {
+			t.Errorf("%s: got kind %d, want internal", s.Name, s.Kind)
+		}
+	}
+	if len(spans) != 4 {
+		t.Fatalf("got spans %v, want 4", spans)
+	}
+
+	rootSpan, childSpan, grandchildSpan, otherSpan := spans["collect"], spans["rpc status"], spans["decode"], spans["unrelated"]
+	if rootSpan.ParentSpanId != "" || otherSpan.ParentSpanId != "" {
+		t.Error("root spans must not have a parent")
+	}
+	if childSpan.TraceId != rootSpan.TraceId || childSpan.ParentSpanId != rootSpan.SpanId {
+		t.Errorf("the child span is not part of the root span: %+v", childSpan)
+	}
+	if grandchildSpan.TraceId != rootSpan.TraceId || grandchildSpan.ParentSpanId != childSpan.SpanId {
+		t.Errorf("the grandchild span is not part of the child span: %+v", grandchildSpan)
+	}
+	if otherSpan.TraceId == rootSpan.TraceId {
+		t.Error("a span started without a parent must start a new trace")
+	}
+
+	if attrs := childSpan.Attributes; len(attrs) != 1 || attrs[0].Key != "rpc.method" || attrs[0].Value.StringValue != "status" {
+		t.Errorf("got attributes %+v", attrs)
+	}
+	if childSpan.Status.Code != 2 || childSpan.Status.Message != "status: 502 Bad Gateway" {
+		t.Errorf("got status %+v for the failed span, want an error", childSpan.Status)
+	}
+	if rootSpan.Status.Code != 0 || rootSpan.Status.Message != "" {
+		t.Errorf("got status %+v for the successful span, want unset", rootSpan.Status)
+	}
+}
+
+func TestTracerExportError(t *testing.T) {
+	c := &collector{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	tracer := NewTracer(srv.URL, "near-exporter")
+
+	tracer.StartRoot("collect").End(nil)
+	err := tracer.Flush()
+	if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable") {
+		t.Fatalf("got error %v, want the status", err)
+	}
+}
+
+func TestTracerQueueLimit(t *testing.T) {
+	tracer := NewTracer("http://localhost:4318", "near-exporter")
+	for i := 0; i < maxQueuedSpans+10; i++ {
+		tracer.StartRoot("collect").End(nil)
+	}
+	if len(tracer.spans) != maxQueuedSpans {
+		t.Errorf("got %d queued spans, want %d", len(tracer.spans), maxQueuedSpans)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	span, ctx := tracer.Start(context.Background(), "collect")
+	span.SetAttribute("key", "value")
+	span.End(errors.New("failed"))
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Error("a nil tracer must not record spans")
+	}
+	if tracer.StartRoot("collect") != nil {
+		t.Error("a nil tracer must not start traces")
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
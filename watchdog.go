@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/madnadyka/near-prometheus-exporter/collector"
+	"github.com/madnadyka/near-prometheus-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type collection struct {
+	name  string
+	start time.Time
+}
+
+// watchdog detects collections which didn't complete within timeout, e.g.
+// because of a deadlock or a hung RPC call, and optionally terminates the
+// process so that a supervisor restarts it.
+type watchdog struct {
+	timeout time.Duration
+	exit    bool
+
+	mu       sync.Mutex
+	names    []string
+	inflight map[*collection]struct{}
+
+	stuckDesc *prometheus.Desc
+}
+
+func newWatchdog(timeout time.Duration, exit bool) *watchdog {
+	return &watchdog{
+		timeout:  timeout,
+		exit:     exit,
+		inflight: make(map[*collection]struct{}),
+		stuckDesc: prometheus.NewDesc(
+			"near_exporter_collector_stuck",
+			"Whether a collection of the collector is running for longer than the watchdog timeout",
+			[]string{"collector"},
+			nil,
+		),
+	}
+}
+
+type watchedCollector struct {
+	prometheus.Collector
+	watchdog *watchdog
+	name     string
+}
+
+// Reset forgets the wrapped collectors, before the collectors are rebuilt.
+func (w *watchdog) Reset() {
+	w.mu.Lock()
+	w.names = nil
+	w.mu.Unlock()
+}
+
+// Wrap watches the collections of c. Collectors may be wrapped repeatedly
+// under the same name, e.g. per request.
+func (w *watchdog) Wrap(name string, c prometheus.Collector) prometheus.Collector {
+	w.mu.Lock()
+	known := false
+	for _, n := range w.names {
+		known = known || n == name
+	}
+	if !known {
+		w.names = append(w.names, name)
+	}
+	w.mu.Unlock()
+	wc := &watchedCollector{Collector: c, watchdog: w, name: name}
+	if cc, ok := c.(collector.ContextCollector); ok {
+		return &watchedContextCollector{watchedCollector: wc, inner: cc}
+	}
+	return wc
+}
+
+// watchedContextCollector is a watchedCollector of a ContextCollector, so
+// that the scrape deadline can wrap it and the watchdog still sees a
+// collection which hangs after the deadline.
+type watchedContextCollector struct {
+	*watchedCollector
+	inner collector.ContextCollector
+}
+
+func (c *watchedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.watch(func() { c.Collector.Collect(ch) })
+}
+
+func (c *watchedContextCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	c.watch(func() { c.inner.CollectContext(ctx, ch) })
+}
+
+// watch runs collect as an in-flight collection of the collector.
+func (c *watchedCollector) watch(collect func()) {
+	col := &collection{name: c.name, start: time.Now()}
+	c.watchdog.mu.Lock()
+	c.watchdog.inflight[col] = struct{}{}
+	c.watchdog.mu.Unlock()
+
+	defer func() {
+		c.watchdog.mu.Lock()
+		delete(c.watchdog.inflight, col)
+		c.watchdog.mu.Unlock()
+	}()
+	collect()
+}
+
+// stuck returns the names of collectors with a collection running longer
+// than the timeout.
+func (w *watchdog) stuck() map[string]bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	res := make(map[string]bool)
+	for col := range w.inflight {
+		if time.Since(col.start) > w.timeout {
+			res[col.name] = true
+		}
+	}
+	return res
+}
+
+func (w *watchdog) Describe(ch chan<- *prometheus.Desc) {
+	ch <- w.stuckDesc
+}
+
+func (w *watchdog) Collect(ch chan<- prometheus.Metric) {
+	stuck := w.stuck()
+	w.mu.Lock()
+	names := append([]string(nil), w.names...)
+	w.mu.Unlock()
+	for _, name := range names {
+		var v float64
+		if stuck[name] {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(w.stuckDesc, prometheus.GaugeValue, v, name)
+	}
+}
+
+// Run checks for stuck collections until the process exits.
+func (w *watchdog) Run() {
+	for range time.Tick(w.timeout / 4) {
+		stuck := w.stuck()
+		if len(stuck) == 0 {
+			continue
+		}
+		for name := range stuck {
+			logging.Error("watchdog: collector stuck", "collector", name, "timeout", w.timeout)
+		}
+		if w.exit {
+			logging.Error("watchdog: exiting")
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// webAuth protects the exporter endpoints with basic auth and/or a bearer
+// token. A request passes if it matches either, or if neither is configured.
+type webAuth struct {
+	user     string
+	password string
+	token    string
+}
+
+func (a webAuth) enabled() bool {
+	return a.user != "" || a.token != ""
+}
+
+func (a webAuth) authorized(r *http.Request) bool {
+	if a.user != "" {
+		if user, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(a.user)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1 {
+			return true
+		}
+	}
+	if a.token != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (a webAuth) Wrap(next http.Handler) http.Handler {
+	if !a.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			if a.user != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="near-exporter"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}